@@ -89,19 +89,34 @@ func (o SetupOption) InitiateOption() logfmt.Option {
 		stdout = term.IsTerminal()
 	}
 	opt := logfmt.Option{
-		Level:        l.Level,
-		LogPath:      CreateLogDir(o.LogPath, l),
-		Rotate:       string(l.Rotate),
-		MaxAge:       l.MaxAge,
-		GzipAge:      l.GzipAge,
-		MaxSize:      int64(l.MaxSize),
-		TotalSizeCap: int64(l.TotalSizeCap),
-		PrintColor:   l.PrintColor,
-		PrintCaller:  l.PrintCaller,
-		Stdout:       stdout,
-		Simple:       l.Simple,
-		Layout:       o.Layout,
-		FixStd:       l.FixStd,
+		Level:           l.Level,
+		LogPath:         CreateLogDir(o.LogPath, l),
+		Rotate:          string(l.Rotate),
+		MaxAge:          l.MaxAge,
+		GzipAge:         l.GzipAge,
+		MaxSize:         int64(l.MaxSize),
+		TotalSizeCap:    int64(l.TotalSizeCap),
+		PrintColor:      l.PrintColor,
+		PrintCaller:     l.PrintCaller,
+		PrintStack:      l.PrintStack,
+		Redact:          l.Redact,
+		RedactKey:       l.RedactKey,
+		Sanitize:        l.Sanitize,
+		MaxEntrySize:    int64(l.MaxEntrySize),
+		Multiline:       l.Multiline,
+		MultilinePrefix: l.MultilinePrefix,
+		Stdout:          stdout,
+		Simple:          l.Simple,
+		Layout:          o.Layout,
+		FixStd:          l.FixStd,
+		StdFields:       l.StdFields,
+		Dedup:           l.Dedup,
+		DedupMask:       l.DedupMask,
+		Async:           l.Async,
+		AsyncOverflow:   l.AsyncOverflow,
+		AsyncQueueSize:  l.AsyncQueueSize,
+		CaptureStderr:   l.CaptureStderr,
+		DumpSignal:      l.DumpSignal,
 	}
 	return opt
 }
@@ -112,7 +127,7 @@ func CreateLogDir(logPath string, logSpec *LogSpec) string {
 		logPath = logSpec.File
 	}
 
-	appName := filepath.Base(os.Args[0])
+	appName := logfmt.AppName
 
 	if logPath == "" {
 		parent := appName
@@ -191,18 +206,33 @@ func CheckPrivileges() bool {
 
 // LogSpec defines the spec structure to be mapped to the log specification.
 type LogSpec struct {
-	Level        string        `spec:"level,info"`
-	File         string        `spec:"file"`
-	Rotate       spec.Layout   `spec:"rotate,.yyyy-MM-dd"`
-	Stdout       string        `spec:"stdout"`
-	MaxAge       time.Duration `spec:"maxAge,30d"`
-	GzipAge      time.Duration `spec:"gzipAge,3d"`
-	MaxSize      spec.Size     `spec:"maxSize,100M"`
-	TotalSizeCap spec.Size     `spec:"totalSizeCap,1G"` // 可选，用来指定所有日志文件的总大小上限，例如设置为3GB的话，那么到了这个值，就会删除旧的日志
-	PrintColor   bool          `spec:"printColor,false"`
-	PrintCaller  bool          `spec:"printCall,false"`
-	Simple       bool          `spec:"simple,false"`
-	FixStd       bool          `spec:"fixstd,true"` // 是否增强log.Print...的输出
+	Level           string        `spec:"level,info"`
+	File            string        `spec:"file"`
+	Rotate          spec.Layout   `spec:"rotate,.yyyy-MM-dd"`
+	Stdout          string        `spec:"stdout"`
+	MaxAge          time.Duration `spec:"maxAge,30d"`
+	GzipAge         time.Duration `spec:"gzipAge,3d"`
+	MaxSize         spec.Size     `spec:"maxSize,100M"`
+	TotalSizeCap    spec.Size     `spec:"totalSizeCap,1G"` // 可选，用来指定所有日志文件的总大小上限，例如设置为3GB的话，那么到了这个值，就会删除旧的日志
+	PrintColor      bool          `spec:"printColor,false"`
+	PrintCaller     bool          `spec:"printCall,false"`
+	PrintStack      string        `spec:"printStack"`       // 打印堆栈的最低级别，例如 error，为空时不打印
+	Redact          string        `spec:"redact"`           // 脱敏规则，例如 mobile|idCard:hash|password:drop，all 表示全部规则
+	RedactKey       string        `spec:"redactKey"`        // 脱敏 hash 方式的 HMAC 密钥，同一部署应使用相同的密钥以便关联，为空时使用进程内随机密钥
+	Sanitize        bool          `spec:"sanitize,true"`    // 是否转义日志文件中消息和字段的控制字符，防止日志注入
+	MaxEntrySize    spec.Size     `spec:"maxEntrySize,0"`   // 单条日志消息和文本字段的总大小上限，超过时截断，0 表示不限制
+	Multiline       string        `spec:"multiline,escape"` // 多行消息的打印方式：escape（默认，转义换行），raw（原样），indent（续行缩进）
+	MultilinePrefix string        `spec:"multilinePrefix"`  // indent 方式的续行前缀，默认两个空格
+	Simple          bool          `spec:"simple,false"`
+	FixStd          bool          `spec:"fixstd,true"`                   // 是否增强log.Print...的输出
+	StdFields       string        `spec:"stdFields,tag"`                 // log.Print...的字段解析方式：tag（默认，仅解析 [F:k=v]），trailing（还解析消息末尾的 k=v）
+	Dedup           time.Duration `spec:"dedup,0"`                       // 合并重复日志的时间窗口，窗口内同级别同调用位置的相同消息只打印首条和末条（附带重复次数），0 表示不合并
+	DedupMask       bool          `spec:"dedupMask,false"`               // 合并重复日志时是否忽略消息中的数字差异
+	Async           bool          `spec:"async,false"`                   // 是否异步写日志，日志在调用方格式化，由后台协程写入
+	AsyncOverflow   string        `spec:"asyncOverflow,dropBelow:error"` // 异步队列满时的处理：block，dropNewest，dropOldest，dropBelow:error（默认，ERROR 及以上等待不丢弃）
+	AsyncQueueSize  int           `spec:"asyncQueueSize,10000"`          // 异步队列的大小，默认 10000
+	CaptureStderr   bool          `spec:"captureStderr,false"`           // 是否捕获进程的标准错误输出（如 panic 和第三方库的输出），作为 ERROR 日志写入，同时仍输出到原标准错误
+	DumpSignal      string        `spec:"dumpSignal"`                    // 触发协程堆栈转储的信号，例如 SIGQUIT，转储按相同堆栈分组写入日志文件旁的 .goroutines.时间 文件，为空时不启用
 }
 
 // Printf calls Output to print to the standard logger.
@@ -220,21 +250,43 @@ func Printf(format string, v ...interface{}) {
 	log.Printf(format, v...)
 }
 
-// LimitConf defines the log limit configuration.
+// LimitConf defines the log limit configuration, see logfmt.LimitConf for the strategies.
 type LimitConf struct {
 	Key       string
 	Level     string
 	EveryNum  int
 	EveryTime time.Duration
+
+	Rate        float64 // 令牌桶每秒补充的令牌数
+	Burst       int     // 令牌桶容量，默认 1
+	First       int     // 采样：每个 Tick 内前 First 条放行
+	Thereafter  int     // 采样：之后每 Thereafter 条放行一条
+	Tick        time.Duration
+	Probability float64 // 按概率采样，(0, 1]
 }
 
 // RegisterLimiter registers a limit for the log generation frequency.
 func RegisterLimiter(c LimitConf) {
 	level, _ := logrus.ParseLevel(c.Level)
 	logfmt.RegisterLimitConf(logfmt.LimitConf{
-		EveryNum:  c.EveryNum,
-		EveryTime: c.EveryTime,
-		Key:       c.Key,
-		Level:     level,
+		EveryNum:    c.EveryNum,
+		EveryTime:   c.EveryTime,
+		Key:         c.Key,
+		Level:       level,
+		Rate:        c.Rate,
+		Burst:       c.Burst,
+		First:       c.First,
+		Thereafter:  c.Thereafter,
+		Tick:        c.Tick,
+		Probability: c.Probability,
 	})
 }
+
+// Limited returns the logrus entry of the standard logger limited by the conf, the key of the registered LimitConf,
+// or the inline one like the xyz in [L:xyz] of the std log messages, e.g. 100,15s:key or tb=10/s,burst=20:key.
+// Like golog.Limited("LimitConf1").Warnf("slow query %s", sql).
+func Limited(conf string) *logrus.Entry { return logfmt.WithLimit(logrus.StandardLogger(), conf) }
+
+// LimitKey returns the field to limit the logrus entry by the conf like Limited,
+// e.g. logger.WithFields(golog.LimitKey("15s:db.slow")).Warn("slow query").
+func LimitKey(conf string) logrus.Fields { return logrus.Fields{logfmt.LimitKey: conf} }
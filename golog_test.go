@@ -1,10 +1,21 @@
 package golog_test
 
 import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/bingoohuang/golog"
+	"github.com/bingoohuang/golog/pkg/rotate"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSetupLogrus(t *testing.T) {
@@ -27,3 +38,83 @@ func TestSetupLogrusLayout(t *testing.T) {
 		logrus.Debugf("这是调试信息 %d", i)
 	}
 }
+
+func TestSetupAsync(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "async.log")
+	g := golog.Setup(golog.Spec("file=" + file + ",stdout=false,async=true,asyncQueueSize=100,asyncOverflow=dropBelow:warn"))
+
+	for i := 0; i < 10; i++ {
+		logrus.Infof("async info %d", i)
+		log.Printf("W! async std warn %d", i)
+	}
+	assert.Len(t, g.Async, 1)
+	_ = g.OnExit()
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, strings.Count(string(data), "async"))
+	stats := g.AsyncStats()
+	assert.Equal(t, uint64(20), stats.Written+stats.Dropped)
+	assert.Equal(t, 0, stats.Queued)
+}
+
+func TestCaptureStderr(t *testing.T) {
+	if file := os.Getenv("GOLOG_TEST_CAPTURE_FILE"); file != "" {
+		_ = golog.Setup(golog.Spec("file=" + file + ",stdout=false,captureStderr=true"))
+		fmt.Fprintln(os.Stderr, "third-party error")
+		fmt.Fprintln(os.Stderr, "panic: recovered by the lib")
+		fmt.Fprintln(os.Stderr, "third-party error after the recovered")
+		rotate.InnerPrint("I! golog debug message")
+		time.Sleep(100 * time.Millisecond)
+		panic("captured boom")
+	}
+
+	file := filepath.Join(t.TempDir(), "capture.log")
+	var stderr bytes.Buffer
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCaptureStderr$")
+	cmd.Env = append(os.Environ(), "GOLOG_TEST_CAPTURE_FILE="+file, "GOLOG_DEBUG=on")
+	cmd.Stderr = &stderr
+	assert.Error(t, cmd.Run())
+	assert.Contains(t, stderr.String(), "third-party error")
+	// the debug messages are printed to the original stderr, not captured into the log
+	assert.Contains(t, stderr.String(), "golog debug message")
+
+	data, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Regexp(t, `ERROR.* third-party error`, string(data))
+	// the capture goes on after the lib printed a panic it recovered
+	assert.Regexp(t, `ERROR.* third-party error after the recovered`, string(data))
+	assert.NotContains(t, string(data), "golog debug message")
+	// the crash is written by the runtime once, not logged again from the captured lines
+	assert.Equal(t, 1, strings.Count(string(data), "panic: captured boom"))
+}
+
+func TestDumpSignal(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dump.log")
+	g := golog.Setup(golog.Spec("file=" + file + ",stdout=false,dumpSignal=SIGHUP"))
+	defer g.OnExit()
+
+	block := make(chan struct{})
+	defer close(block)
+	for i := 0; i < 10; i++ {
+		go func() { <-block }()
+	}
+
+	time.Sleep(50 * time.Millisecond) // all blocked
+	p, _ := os.FindProcess(os.Getpid())
+	assert.NoError(t, p.Signal(syscall.SIGHUP))
+
+	var dumps []string
+	for i := 0; i < 100 && len(dumps) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		dumps, _ = filepath.Glob(file + ".goroutines.*")
+	}
+	if assert.Len(t, dumps, 1) {
+		time.Sleep(10 * time.Millisecond)
+		data, _ := os.ReadFile(dumps[0])
+		assert.Regexp(t, `goroutine dump at .*, \d+ goroutines, \d+ unique stacks`, string(data))
+		// grouped by the identical stacks, with the frames formatted like the %stack
+		assert.Regexp(t, `goroutines: 10\n(\t.*\n)*\t\S+golog_test.TestDumpSignal.func1 \S*golog_test.go:\d+\n`, string(data))
+		assert.Equal(t, 1, strings.Count(string(data), "golog_test.TestDumpSignal.func1 "))
+	}
+}
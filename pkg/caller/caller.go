@@ -9,7 +9,7 @@ import (
 
 const (
 	maximumCallerDepth = 25
-	// Skip is the key to set/get call skip value.
+	// Skip is the key to set/get the extra frames to skip above the detected caller, -1 to skip printing.
 	Skip      = "_CallerSkip"
 	GidKey    = "_CallerGid"
 	CallerKey = "_CallerCaller"
@@ -22,6 +22,8 @@ var (
 )
 
 // GetCaller retrieves the name of the first non-logrus calling function
+//
+// Deprecated: use Detect instead, which skips the golog and logrus frames automatically.
 func GetCaller(skip int, terminalPkg string) *runtime.Frame {
 	// cache this package's fully-qualified name
 	callerInitOnce.Do(func() {
@@ -0,0 +1,158 @@
+package caller
+
+import (
+	"path"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// skipPackages holds the packages (map[string]bool) whose frames are skipped when detecting the caller,
+// copied on write by RegisterSkipPackage.
+var skipPackages atomic.Value
+
+func init() {
+	skipPackages.Store(map[string]bool{
+		"runtime":                    true,
+		"log":                        true,
+		"github.com/sirupsen/logrus": true,
+
+		"github.com/bingoohuang/golog":            true,
+		"github.com/bingoohuang/golog/pkg/caller": true,
+		"github.com/bingoohuang/golog/pkg/logfmt": true,
+		"github.com/bingoohuang/golog/pkg/rotate": true,
+		"github.com/bingoohuang/golog/pkg/stack":  true,
+	})
+}
+
+var skipPackagesLock sync.Mutex
+
+// RegisterSkipPackage registers the packages to be skipped when detecting the caller,
+// like the logging wrapper packages of the application.
+func RegisterSkipPackage(pkgs ...string) {
+	skipPackagesLock.Lock()
+	defer skipPackagesLock.Unlock()
+
+	old := skipPackages.Load().(map[string]bool)
+	m := make(map[string]bool, len(old)+len(pkgs))
+	for k := range old {
+		m[k] = true
+	}
+	for _, p := range pkgs {
+		m[p] = true
+	}
+
+	skipPackages.Store(m)
+}
+
+// IsSkipPackage tells whether the package is skipped when detecting the caller.
+func IsSkipPackage(pkg string) bool {
+	return skipPackages.Load().(map[string]bool)[pkg]
+}
+
+type cachedFrame struct {
+	runtime.Frame
+	pkg string
+}
+
+// frameCache caches the frames (inlined ones included) by PC, map[uintptr][]cachedFrame.
+var frameCache sync.Map
+
+func lookupFrames(pc uintptr) []cachedFrame {
+	if v, ok := frameCache.Load(pc); ok {
+		return v.([]cachedFrame)
+	}
+
+	var cfs []cachedFrame
+	frames := runtime.CallersFrames([]uintptr{pc})
+	for {
+		f, more := frames.Next()
+		cfs = append(cfs, cachedFrame{Frame: f, pkg: GetPackageName(f.Function)})
+		if !more {
+			break
+		}
+	}
+
+	frameCache.Store(pc, cfs)
+	return cfs
+}
+
+// Detect returns the frame of the first function outside the logging internals (logrus, log, golog and
+// the registered skip packages), with the further skip frames ascended, or nil if not found.
+func Detect(skip int) *runtime.Frame {
+	if fs := DetectN(skip, 1); len(fs) > 0 {
+		return &fs[0]
+	}
+
+	return nil
+}
+
+// DetectN returns at most n frames from the detected caller like Detect.
+func DetectN(skip, n int) []runtime.Frame {
+	var pcs [maximumCallerDepth * 2]uintptr
+	depth := runtime.Callers(2, pcs[:])
+
+	var result []runtime.Frame
+	detected := false
+	for _, pc := range pcs[:depth] {
+		for _, f := range lookupFrames(pc) {
+			if !detected {
+				if IsSkipPackage(f.pkg) {
+					continue
+				}
+				detected = true
+			}
+
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			if result = append(result, f.Frame); len(result) >= n {
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+var mainModulePath = func() string {
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		return bi.Main.Path
+	}
+	return ""
+}()
+
+// RelativePath returns the file path of the frame relative to its module root, like pkg/caller/detect.go,
+// or qualified by the module path for the frames outside the main module.
+func RelativePath(f runtime.Frame) string {
+	dir, file := path.Split(f.File)
+	pkg := GetPackageName(f.Function)
+	if pkg == "main" {
+		return file
+	}
+
+	// the directory is resolved from the file, since the package path differs from it
+	// like the external test package pkg/logfmt_test in the directory pkg/logfmt
+	if base := path.Base(dir); base != path.Base(pkg) && base != "." && base != "/" {
+		if i := strings.LastIndex(pkg, "/"); i >= 0 {
+			pkg = pkg[:i+1] + base
+		} else {
+			pkg = base
+		}
+	}
+
+	if mainModulePath != "" {
+		if pkg == mainModulePath {
+			return file
+		}
+		if strings.HasPrefix(pkg, mainModulePath+"/") {
+			return pkg[len(mainModulePath)+1:] + "/" + file
+		}
+	}
+
+	return pkg + "/" + file
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,7 +15,10 @@ type Metrics struct {
 
 	contentEncoding string
 
-	payload bytes.Buffer
+	// payload is the body written of the JSON content, kept up to payloadCap bytes to truncate once when logged,
+	// and payloadOmitted is the number of the bytes beyond.
+	payload        bytes.Buffer
+	payloadOmitted int
 	// Code is the first http response code passed to the WriteHeader func of
 	// the ResponseWriter. If no such call is made, a default code of 200 is
 	// assumed instead.
@@ -85,9 +89,9 @@ func (m *Metrics) CaptureMetrics(w http.ResponseWriter, fn func(http.ResponseWri
 					m.contentEncoding = h.Get("Content-Encoding")
 					m.contentLength, _ = strconv.ParseInt(h.Get("Content-Length"), 10, 64)
 
-					payload, extra := AbbreviateBytesEnv(h.Get("Content-Type"), p[:n])
-					m.payload.WriteString(payload)
-					m.payload.WriteString(extra)
+					if strings.HasPrefix(h.Get("Content-Type"), "application/json") {
+						m.capturePayload(p[:n])
+					}
 
 					return n, err
 				}
@@ -108,3 +112,25 @@ func (m *Metrics) CaptureMetrics(w http.ResponseWriter, fn func(http.ResponseWri
 	fn(Wrap(w, hooks))
 	m.Duration += time.Since(start)
 }
+
+// payloadRedactSlack is the extra bytes of the payload captured beyond the ones to log,
+// so that the sensitive values like the card numbers across the truncation boundary are still redacted in whole.
+const payloadRedactSlack = 256
+
+// payloadCap returns the max bytes of the payload to capture, enough for the MAX_PAYLOAD_SIZE runes to log,
+// plus the slack to redact before truncated.
+func payloadCap() int {
+	return 4*EnvSize("MAX_PAYLOAD_SIZE", 1024) + payloadRedactSlack
+}
+
+func (m *Metrics) capturePayload(p []byte) {
+	room := payloadCap() - m.payload.Len()
+	if room < 0 {
+		room = 0
+	}
+	if len(p) > room {
+		m.payloadOmitted += len(p) - room
+		p = p[:room]
+	}
+	m.payload.Write(p)
+}
@@ -7,6 +7,7 @@ import (
 	"runtime/debug"
 	"time"
 
+	"github.com/bingoohuang/golog/pkg/redact"
 	"github.com/segmentio/ksuid"
 	"github.com/sirupsen/logrus"
 )
@@ -78,6 +79,7 @@ func (dl *HLog) LogRequest(side string, r *http.Request) {
 	dl.RequestID = ksuid.New().String()
 	contentEncoding := r.Header.Get("Content-Encoding")
 	reqDump, _ := httputil.DumpRequest(r, contentEncoding == "")
+	reqDump = redact.Default().Bytes(reqDump)
 
 	payload, extra := AbbreviateBytesEnv(r.Header.Get("Content-Type"), reqDump)
 	dl.Printf("I! %s Request ID: %s %s %s", side, dl.RequestID, payload, extra)
@@ -99,12 +101,13 @@ func (dl *HLog) LogResponse(side string, req *http.Request, res *http.Response,
 	} else {
 		rspContentEncoding := res.Header.Get("Content-Encoding")
 		rspDump, _ := httputil.DumpResponse(res, rspContentEncoding == "")
+		rspDump = redact.Default().Bytes(rspDump)
 		payload, extra := AbbreviateBytesEnv(res.Header.Get("Content-Type"), rspDump)
 
 		if err != nil {
 			dl.Printf("I! %s Response ID: %s Duration: %s error: %v Dump: %s%s", side, dl.RequestID, duration, err, payload, extra)
 		} else {
-			dl.Printf("I! %s Response ID: %s Duration: %s Dump: %s%s", side, dl.RequestID, duration, rspDump, extra)
+			dl.Printf("I! %s Response ID: %s Duration: %s Dump: %s%s", side, dl.RequestID, duration, payload, extra)
 		}
 	}
 }
@@ -6,6 +6,9 @@ import (
 	"runtime/debug"
 	"strings"
 	"time"
+
+	"github.com/bingoohuang/golog/pkg/logfmt"
+	"github.com/bingoohuang/golog/pkg/redact"
 )
 
 // LogWrapper is a log wrap to wrap http service.
@@ -70,10 +73,19 @@ func (dl LogWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request, h http.Ha
 		if status == 0 {
 			status = http.StatusOK
 		}
-		v.LogWriter(time.Since(startTime), status, m.Header, m.payload.String())
+		if l, ok := v.(payloadWriterLogger); ok {
+			l.logWriter(time.Since(startTime), status, m.Header, m.payload.String(), m.payloadOmitted)
+		} else {
+			v.LogWriter(time.Since(startTime), status, m.Header, m.payload.String())
+		}
 	}
 }
 
+// payloadWriterLogger logs the server writer with the number of the payload bytes omitted in capturing.
+type payloadWriterLogger interface {
+	logWriter(duration time.Duration, status int, header http.Header, payload string, omitted int)
+}
+
 // HTTPWriterLogger logs the server writer.
 type HTTPWriterLogger interface {
 	LogWriter(duration time.Duration, status int, header http.Header, payload string)
@@ -84,12 +96,23 @@ func AbbreviateBytes(s []byte, n int) (string, string) {
 }
 
 func Abbreviate(s string, n int) (string, string) {
+	return abbreviate(s, n, 0)
+}
+
+// abbreviate abbreviates s to n runes, the omitted bytes beyond s are counted in the truncated ones.
+func abbreviate(s string, n, omitted int) (string, string) {
 	r := []rune(s)
-	if len(r) <= n {
+	if len(r) <= n && omitted == 0 {
 		return s, ""
 	}
 
-	return string(r[:n]), "..."
+	prefix := s
+	if len(r) > n {
+		prefix = string(r[:n])
+	}
+	truncated := len(s) - len(prefix) + omitted
+	logfmt.CountTruncated(truncated)
+	return prefix, logfmt.TruncateMarker(truncated)
 }
 
 func AbbreviateBytesEnv(contentType string, s []byte) (string, string) {
@@ -101,8 +124,12 @@ func AbbreviateBytesEnv(contentType string, s []byte) (string, string) {
 }
 
 func AbbreviateEnv(contentType, s string) (string, string) {
+	return abbreviateEnv(contentType, s, 0)
+}
+
+func abbreviateEnv(contentType, s string, omitted int) (string, string) {
 	if strings.HasPrefix(contentType, "application/json") {
-		return Abbreviate(s, EnvSize("MAX_PAYLOAD_SIZE", 1024))
+		return abbreviate(s, EnvSize("MAX_PAYLOAD_SIZE", 1024), omitted)
 	}
 
 	return "ignored", "..."
@@ -110,9 +137,36 @@ func AbbreviateEnv(contentType, s string) (string, string) {
 
 // LogWriter logs the writer information.
 func (dl *HLog) LogWriter(duration time.Duration, status int, header http.Header, payload string) {
-	payload, extra := AbbreviateEnv(header.Get("Content-Type"), payload)
+	dl.logWriter(duration, status, header, payload, 0)
+}
+
+// logWriter logs the writer information, the payload captured is redacted first, and then truncated once,
+// like the client ones, so that the sensitive values cut at the boundary are not logged in the clear.
+func (dl *HLog) logWriter(duration time.Duration, status int, header http.Header, payload string, omitted int) {
+	payload, extra := abbreviateEnv(header.Get("Content-Type"), redact.Default().String(payload), omitted)
 	dl.Printfer.Printf("Server Response ID: %s duration: %s status: %d header: %s payload: %s%s", dl.RequestID,
-		duration, status, header, payload, extra)
+		duration, status, redactHeader(header), payload, extra)
+}
+
+// redactHeader returns the header with the sensitive values like Set-Cookie redacted by the default redactor.
+func redactHeader(header http.Header) http.Header {
+	r := redact.Default()
+	if r == nil {
+		return header
+	}
+
+	h := make(http.Header, len(header))
+	for k, vs := range header {
+		rvs := make([]string, 0, len(vs))
+		for _, v := range vs {
+			if rv, keep := r.Field(k, v); keep {
+				rvs = append(rvs, rv)
+			}
+		}
+		h[k] = rvs
+	}
+
+	return h
 }
 
 type StdLogger struct{}
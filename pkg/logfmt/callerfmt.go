@@ -0,0 +1,94 @@
+package logfmt
+
+import (
+	"bytes"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/bingoohuang/golog/pkg/caller"
+	"github.com/bingoohuang/golog/pkg/stack"
+)
+
+// CallerFormat defines how to print the caller frame, the zero value prints like "logfmt.Format format.go:12".
+type CallerFormat struct {
+	// Path is one of base (default, file name only), relative (relative to the module root) and full.
+	Path string
+	// Func is one of short (default, with the short package like logfmt.Format),
+	// pkg (qualified by the full package path), name (without package) and none.
+	Func string
+	// Sep is the separator between the file and the line, default ":".
+	Sep string
+}
+
+func parseCallerFormat(m map[string]string) CallerFormat {
+	return CallerFormat{Path: strings.ToLower(m["path"]), Func: strings.ToLower(m["func"]), Sep: m["sep"]}
+}
+
+// Append appends the caller frame to b.
+func (c CallerFormat) Append(b *bytes.Buffer, f *runtime.Frame) {
+	switch c.Func {
+	case "none":
+	case "pkg":
+		b.WriteString(f.Function)
+		b.WriteByte(' ')
+	case "name":
+		name := filepath.Base(f.Function)
+		if i := strings.Index(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		b.WriteString(name)
+		b.WriteByte(' ')
+	default:
+		b.WriteString(filepath.Base(f.Function))
+		b.WriteByte(' ')
+	}
+
+	switch c.Path {
+	case "full":
+		b.WriteString(f.File)
+	case "relative":
+		b.WriteString(caller.RelativePath(*f))
+	default:
+		b.WriteString(filepath.Base(f.File))
+	}
+
+	if c.Sep == "" {
+		b.WriteByte(':')
+	} else {
+		b.WriteString(c.Sep)
+	}
+	b.WriteString(strconv.Itoa(f.Line))
+}
+
+// entryFrame returns the caller frame of the entry, with the further skip frames ascended.
+// The frame recorded in the caller.CallerKey field takes precedence, caller.Skip field with -1 disables it,
+// or with a positive value to skip more frames like in the logging wrappers.
+func entryFrame(e Entry, skip int) *runtime.Frame {
+	fs := e.Fields()
+	switch v := fs[caller.CallerKey].(type) {
+	case *runtime.Frame:
+		if v != nil {
+			return v
+		}
+	case *stack.Call:
+		if v != nil {
+			f := v.Frame()
+			return &f
+		}
+	}
+
+	if v, ok := fs[caller.Skip].(int); ok {
+		if v < 0 {
+			return nil
+		}
+		skip += v
+	}
+
+	if f := e.Caller(); f != nil && skip == 0 && !caller.IsSkipPackage(caller.GetPackageName(f.Function)) {
+		return f
+	}
+
+	return caller.Detect(skip)
+}
@@ -0,0 +1,60 @@
+package logfmt_test
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/golog/pkg/logfmt"
+	"github.com/bingoohuang/golog/pkg/rotate"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallerDetect(t *testing.T) {
+	var buf bytes.Buffer
+	layout, err := logfmt.NewLayout(logfmt.Option{Layout: "%caller{level=trace} | %caller{level=trace,path=relative,func=name,sep=#}%n"})
+	assert.Nil(t, err)
+
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.AddHook(logfmt.NewHook([]*rotate.WriterFormatter{{
+		LevelWriter: rotate.WrapLevelWriter(&buf),
+		Formatter:   &logfmt.LogrusFormatter{Formatter: logfmt.Formatter{Layout: layout}},
+	}}))
+
+	ll.Info("hello")
+	_, _, line, _ := runtime.Caller(0)
+	l := strconv.Itoa(line - 1)
+	// the path of the external test package logfmt_test is resolved from its directory
+	assert.Equal(t, "logfmt_test.TestCallerDetect callerfmt_test.go:"+l+
+		" | TestCallerDetect pkg/logfmt/callerfmt_test.go#"+l+"\n", buf.String())
+}
+
+func TestCallerDetectStdLog(t *testing.T) {
+	stdout, stdFlags, stdPrefix, stdWriter := os.Stdout, log.Flags(), log.Prefix(), log.Writer()
+	t.Cleanup(func() {
+		os.Stdout = stdout
+		log.SetFlags(stdFlags)
+		log.SetPrefix(stdPrefix)
+		log.SetOutput(stdWriter)
+	})
+
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	logfmt.Option{Stdout: true, FixStd: true, Simple: true, PrintCaller: true}.Setup(logrus.New())
+	os.Stdout = stdout
+
+	log.Print("hello")
+	_, _, line, _ := runtime.Caller(0)
+	_ = w.Close()
+	out, _ := io.ReadAll(r)
+
+	assert.Contains(t, string(out), "logfmt_test.TestCallerDetectStdLog callerfmt_test.go:"+strconv.Itoa(line-1)+" ")
+	assert.True(t, strings.HasSuffix(string(out), " : hello\n"), string(out))
+}
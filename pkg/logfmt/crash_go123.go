@@ -0,0 +1,22 @@
+//go:build go1.23
+
+package logfmt
+
+import (
+	"os"
+	"runtime/debug"
+)
+
+// crashOutputSupported tells whether the runtime crash output can be set to the log file.
+const crashOutputSupported = true
+
+// setCrashOutput sets the log file as the additional output of the runtime crash, like the unrecovered panics.
+func setCrashOutput(logFile string) error {
+	f, err := os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // duplicated by SetCrashOutput
+
+	return debug.SetCrashOutput(f, debug.CrashOptions{})
+}
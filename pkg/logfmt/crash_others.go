@@ -0,0 +1,9 @@
+//go:build !go1.23
+
+package logfmt
+
+// crashOutputSupported tells whether the runtime crash output can be set to the log file.
+const crashOutputSupported = false
+
+// setCrashOutput does nothing before go1.23, the crash output is only captured from the stderr.
+func setCrashOutput(string) error { return nil }
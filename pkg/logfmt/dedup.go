@@ -0,0 +1,107 @@
+package logfmt
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// numbersRe matches the numbers to mask in the messages to dedup.
+var numbersRe = regexp.MustCompile(`\d+`)
+
+// Dedup collapses the duplicate messages of the same level and caller within the window,
+// like the "last message repeated N times" of syslog. The first one is logged at once,
+// and the last duplicate is logged at the end of the window annotated like (+5 similar).
+// The keys are kept in its own store apart from the limiter ones, and expired after their windows.
+type Dedup struct {
+	// Window is the window to collapse the duplicate messages in.
+	Window time.Duration
+	// MaskNumbers takes the messages different only in numbers as duplicates, like "retry 1" and "retry 2".
+	MaskNumbers bool
+	// MaxKeys is the max number of the keys in the window, default 10000, the messages of the new keys beyond are not collapsed.
+	MaxKeys int
+
+	mu    sync.Mutex
+	keys  map[string]*limitRuntime
+	sweep time.Time
+}
+
+// key returns the dedup key of the entry, by the level, the caller and the normalized message.
+func (d *Dedup) key(e *logrus.Entry) string {
+	msg := strings.TrimSpace(e.Message)
+	if d.MaskNumbers {
+		msg = numbersRe.ReplaceAllLiteralString(msg, "#")
+	}
+
+	call := ""
+	if f := entryFrame(LogrusEntry{Entry: e}, 0); f != nil {
+		call = f.File + ":" + strconv.Itoa(f.Line)
+	}
+
+	return "dedup:" + LogrusEntry{Entry: e}.Level() + ":" + call + ":" + msg
+}
+
+// allow tells whether the entry is allowed, and returns its message annotated with the number of the collapsed ones.
+func (d *Dedup) allow(e *logrus.Entry) (string, bool) {
+	if d == nil || d.Window <= 0 || e.Level <= logrus.FatalLevel {
+		return e.Message, true
+	}
+
+	rt := d.runtime(d.key(e), e.Level)
+	if rt == nil {
+		return e.Message, true
+	}
+
+	// the pending one is logged with the fields of the entry, at the time of emission
+	name, _ := e.Data[LevelKey].(string)
+	msg, allowed := rt.Allow(e.WithTime(time.Time{}), e.Level, name, []byte(e.Message), nil)
+	return string(msg), allowed
+}
+
+// runtime gets the runtime of the key, or creates it, nil when the keys reach the max.
+// The keys without the pending message in the window are expired, swept once a window.
+func (d *Dedup) runtime(key string, level logrus.Level) *limitRuntime {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := time.Now()
+	if d.keys == nil {
+		d.keys = map[string]*limitRuntime{}
+	}
+	if now.Sub(d.sweep) >= d.Window {
+		d.sweep = now
+		for k, rt := range d.keys {
+			if rt.idle(now, d.Window) {
+				delete(d.keys, k)
+			}
+		}
+	}
+
+	if rt := d.keys[key]; rt != nil {
+		return rt
+	}
+
+	maxKeys := d.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = 10000
+	}
+	if len(d.keys) >= maxKeys {
+		return nil
+	}
+
+	rt := &limitRuntime{conf: &LimitConf{Key: key, EveryTime: d.Window, Level: level}}
+	d.keys[key] = rt
+	return rt
+}
+
+// Keys returns the number of the keys in the store.
+func (d *Dedup) Keys() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.keys)
+}
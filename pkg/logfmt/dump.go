@@ -0,0 +1,83 @@
+package logfmt
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bingoohuang/golog/pkg/stack"
+)
+
+// signalNames are the names of the signals to trap, the ones of the platform are added in init.
+var signalNames = map[string]os.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+}
+
+// ParseSignal parses the signal name like SIGQUIT or QUIT, case-insensitively.
+func ParseSignal(name string) (os.Signal, error) {
+	if sig, ok := signalNames[strings.TrimPrefix(strings.ToUpper(name), "SIG")]; ok {
+		return sig, nil
+	}
+
+	return nil, fmt.Errorf("unknown signal %s", name)
+}
+
+type goroutineGroup struct {
+	stack stack.CallStack
+	count int
+}
+
+// DumpGoroutines writes the stacks of all the goroutines to w, grouped by the identical stacks,
+// the most common ones first, with the frames formatted like the %stack in the Layout.
+func DumpGoroutines(w io.Writer) error {
+	var records []runtime.StackRecord
+	for n, ok := runtime.GoroutineProfile(nil); !ok; {
+		records = make([]runtime.StackRecord, n+10)
+		n, ok = runtime.GoroutineProfile(records)
+		records = records[:n]
+	}
+
+	index := map[string]*goroutineGroup{}
+	var groups []*goroutineGroup
+	for i := range records {
+		pcs := records[i].Stack()
+		key := fmt.Sprint(pcs)
+		g := index[key]
+		if g == nil {
+			g = &goroutineGroup{stack: stack.FromPCs(pcs)}
+			index[key] = g
+			groups = append(groups, g)
+		}
+		g.count++
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].count > groups[j].count })
+
+	p, _ := parseStackPart("")
+	b := bufio.NewWriter(w)
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(b, "goroutine dump at %s, %d goroutines, %d unique stacks\n",
+		time.Now().Format(layout), len(records), len(groups))
+	for _, g := range groups {
+		buf.Reset()
+		fmt.Fprintf(buf, "\ngoroutines: %d", g.count)
+		for _, c := range g.stack {
+			f := c.Frame()
+			buf.WriteString("\n\t")
+			p.CallerFormat.Append(buf, &f)
+		}
+		buf.WriteByte('\n')
+		_, _ = b.Write(buf.Bytes())
+	}
+
+	return b.Flush()
+}
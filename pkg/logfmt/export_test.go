@@ -0,0 +1,30 @@
+package logfmt
+
+import "testing"
+
+// RestoreLevels restores the registered custom levels and level keys after the test,
+// so that the registrations in the test do not leak into the others.
+func RestoreLevels(t testing.TB) {
+	savedLevels := levels.Load()
+	savedKeys, _ := levelKeys.Load().([]LevelKeyConf)
+
+	t.Cleanup(func() {
+		levels.Store(savedLevels)
+		levelKeys.Store(savedKeys)
+	})
+}
+
+// ResetLimiter closes and removes the limit keys after the test,
+// so that the pending messages and the keys of the test do not leak into the others.
+func ResetLimiter(t testing.TB) {
+	t.Cleanup(func() {
+		limiterLock.Lock()
+		keys := limiter
+		limiter = map[string]*limitRuntime{}
+		limiterLock.Unlock()
+
+		for _, rt := range keys {
+			rt.close()
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package logfmt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bingoohuang/golog/pkg/str"
+	"github.com/sirupsen/logrus"
+)
+
+// FieldsOrderKey is the key of the insertion order ([]string) of the fields recorded by WithOrderedFields.
+const FieldsOrderKey = "_GologFieldsOrder"
+
+// FieldsWither is the logrus.Logger or logrus.Entry to add fields.
+type FieldsWither interface {
+	WithFields(fields logrus.Fields) *logrus.Entry
+}
+
+// WithOrderedFields adds the fields of key-value pairs like "userId", 100, "orderId", 200 to the logger,
+// and records their insertion order for the %fields{order=insertion}.
+func WithOrderedFields(l FieldsWither, kvs ...interface{}) *logrus.Entry {
+	fs := make(logrus.Fields, len(kvs)/2+1)
+	var order []string
+	if e, ok := l.(*logrus.Entry); ok {
+		order, _ = e.Data[FieldsOrderKey].([]string)
+	}
+	order = order[:len(order):len(order)] // copy on append, the order of the parent entry is shared
+
+	for i := 0; i+1 < len(kvs); i += 2 {
+		k := fmt.Sprint(kvs[i])
+		fs[k] = kvs[i+1]
+		order = append(order, k)
+	}
+	fs[FieldsOrderKey] = order
+
+	return l.WithFields(fs)
+}
+
+// FieldEncoder encodes the field values by their types for both the text and the JSON outputs:
+// errors with their cause chains, time.Duration in human form like 1.5s, time.Time like the %time part,
+// fmt.Stringer by its String, and []byte as text when it is printable, or else base64.
+type FieldEncoder struct {
+	// Time formats time.Time, default in 2006-01-02 15:04:05.000.
+	Time *Time
+}
+
+// Value converts the field value to the one to marshal as JSON.
+func (c FieldEncoder) Value(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil, string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case error:
+		if isNilPointer(v) {
+			return nil
+		}
+		if causes := errorCauses(t); len(causes) > 0 {
+			return map[string]interface{}{"message": t.Error(), "causes": causes}
+		}
+		return t.Error()
+	case time.Time:
+		if c.Time == nil {
+			return t.Format(layout)
+		}
+		return c.Time.String(t)
+	case time.Duration:
+		return t.String()
+	case []byte:
+		if isPrintable(t) {
+			return string(t)
+		}
+		return base64.StdEncoding.EncodeToString(t)
+	case json.Marshaler:
+		return v
+	case fmt.Stringer:
+		if isNilPointer(v) {
+			return nil
+		}
+		return t.String()
+	default:
+		return v
+	}
+}
+
+// Fields converts the field values to the ones to marshal as JSON.
+func (c FieldEncoder) Fields(fs Fields) map[string]interface{} {
+	m := make(map[string]interface{}, len(fs))
+	for k, v := range fs {
+		m[k] = c.Value(v)
+	}
+
+	return m
+}
+
+// AppendJSON appends the fields as a JSON object.
+func (c FieldEncoder) AppendJSON(b *bytes.Buffer, fs Fields) {
+	if v, err := json.Marshal(c.Fields(fs)); err == nil {
+		b.Write(v)
+	}
+}
+
+// AppendOrderedJSON appends the fields of the keys as a JSON object in the order of the keys.
+func (c FieldEncoder) AppendOrderedJSON(b *bytes.Buffer, fs Fields, keys []string) {
+	b.WriteByte('{')
+	n := 0
+	for _, k := range keys {
+		v, err := json.Marshal(c.Value(fs[k]))
+		if err != nil {
+			continue
+		}
+
+		if n++; n > 1 {
+			b.WriteByte(',')
+		}
+		kj, _ := json.Marshal(k)
+		b.Write(kj)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+}
+
+// AppendKV appends the fields of the keys like userId=100 name="bingoo huang", separated by spaces.
+func (c FieldEncoder) AppendKV(b *bytes.Buffer, fs Fields, keys []string) {
+	buf := str.GetBytesBuffer()
+	defer str.PutBytesBuffer(buf)
+
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+
+		buf.Reset()
+		c.AppendText(buf, fs[k])
+		b.WriteString(sanitizeText(fs, k))
+		b.WriteByte('=')
+		if v := sanitizeText(fs, buf.String()); needsQuote(v) {
+			b.WriteString(strconv.Quote(v))
+		} else {
+			b.WriteString(v)
+		}
+	}
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+
+	for _, r := range s {
+		if r == '=' || r == '"' || unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AppendText appends the field value as text, like the error message with its causes not contained in it.
+func (c FieldEncoder) AppendText(b *bytes.Buffer, v interface{}) {
+	if err, ok := v.(error); ok && !isNilPointer(v) {
+		b.WriteString(errorText(err))
+		return
+	}
+
+	switch t := c.Value(v).(type) {
+	case string:
+		b.WriteString(t)
+	case nil:
+	default:
+		_, _ = fmt.Fprint(b, t)
+	}
+}
+
+// errorCauses returns the messages of the errors in the chain by errors.Unwrap or the Cause of github.com/pkg/errors,
+// the ones same as their wrappers (like the withStack of github.com/pkg/errors) are ignored.
+func errorCauses(err error) []string {
+	var causes []string
+	last := err.Error()
+	for {
+		if j, ok := err.(interface{ Unwrap() []error }); ok { // errors.Join
+			for _, e := range j.Unwrap() {
+				causes = append(causes, e.Error())
+			}
+			return causes
+		}
+
+		if err = unwrapCause(err); err == nil {
+			return causes
+		}
+
+		if msg := err.Error(); msg != last {
+			causes = append(causes, msg)
+			last = msg
+		}
+	}
+}
+
+// errorText returns the error message, with the causes not contained in the message appended.
+func errorText(err error) string {
+	msg := err.Error()
+	text := msg
+	for _, c := range errorCauses(err) {
+		if !strings.Contains(msg, c) {
+			text += "; caused by: " + c
+		}
+	}
+
+	return text
+}
+
+func isPrintable(p []byte) bool {
+	if !utf8.Valid(p) {
+		return false
+	}
+
+	for _, r := range string(p) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
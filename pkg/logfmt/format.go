@@ -2,7 +2,6 @@ package logfmt
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,10 +10,10 @@ import (
 	"time"
 
 	"github.com/bingoohuang/golog/pkg/caller"
-	"github.com/bingoohuang/golog/pkg/gid"
-	"github.com/bingoohuang/golog/pkg/stack"
+	"github.com/bingoohuang/golog/pkg/redact"
 	"github.com/bingoohuang/golog/pkg/str"
 	"github.com/bingoohuang/golog/pkg/timex"
+	"github.com/sirupsen/logrus"
 )
 
 // Fields type, used to pass to `WithFields`.
@@ -53,9 +52,59 @@ type Formatter struct {
 	PrintColor  bool
 	PrintCaller bool
 	Simple      bool
+	// Caller defines how to print the caller when PrintCaller is true.
+	Caller CallerFormat
+	// Stack prints the stack trace as the stack key in the fields JSON when it is not nil.
+	Stack *StackPart
+	// Redactor redacts the sensitive data in the message and fields when it is not nil.
+	Redactor *redact.Redactor
+	// Sanitize escapes the control characters in the message and fields, like for the log files.
+	Sanitize bool
+	// MaxEntrySize is the max bytes of the message and the text fields in total, 0 for unlimited.
+	MaxEntrySize int
+	// SkipMetrics skips counting the truncations in the metrics, like by the formatters except the first one
+	// of the same entries, so that each entry is counted once.
+	SkipMetrics bool
+	// Multiline defines how to print the multi-line messages.
+	Multiline Multiline
 }
 
-var Pid = os.Getpid()
+var (
+	Pid = os.Getpid()
+	// AppName is the binary name of the application, which is also the default log file name.
+	AppName = filepath.Base(os.Args[0])
+)
+
+// SeqKey is the key of the per-process sequence number of the entry, assigned by the Hook.
+const SeqKey = "_GologSeq"
+
+// isInternalKey tells whether the field key is used internally by golog, which should not be printed.
+func isInternalKey(k string) bool {
+	return strings.HasPrefix(k, "_Golog") || strings.HasPrefix(k, "_Caller")
+}
+
+// visibleFields returns the fields without the internal keys.
+func visibleFields(fs Fields) Fields {
+	internals := 0
+	for k := range fs {
+		if isInternalKey(k) {
+			internals++
+		}
+	}
+
+	if internals == 0 {
+		return fs
+	}
+
+	m := make(Fields, len(fs)-internals)
+	for k, v := range fs {
+		if !isInternalKey(k) {
+			m[k] = v
+		}
+	}
+
+	return m
+}
 
 const (
 	layout = "2006-01-02 15:04:05.000"
@@ -65,6 +114,16 @@ const (
 func (f Formatter) Format(e Entry) []byte {
 	b := &bytes.Buffer{}
 
+	if f.Redactor != nil {
+		e = redactEntry(e, f.Redactor)
+	}
+	if f.Sanitize {
+		e = sanitizeEntry(e)
+	}
+	if f.MaxEntrySize > 0 {
+		e = truncateEntry(e, f.MaxEntrySize, !f.SkipMetrics)
+	}
+
 	if f.Layout != nil {
 		f.Layout.Append(b, e)
 		return b.Bytes()
@@ -79,79 +138,79 @@ func (f Formatter) Format(e Entry) []byte {
 	fs := e.Fields()
 	if !f.Simple {
 		w(fmt.Sprintf("%d --- ", Pid))
-		var goroutineID gid.GoroutineID
-		if v, ok := fs[caller.GidKey]; ok {
-			goroutineID = v.(gid.GoroutineID)
-			delete(fs, caller.GidKey)
-		} else {
-			goroutineID = gid.CurGoroutineID()
-		}
-		w(fmt.Sprintf("[%-5s] ", goroutineID))
+		w(fmt.Sprintf("[%-5s] ", entryGid(fs)))
 		w(fmt.Sprintf("[%s] ", str.Or(e.TraceID(), "-")))
 	}
 
-	callSkip := 0
-	if v, ok := fs[caller.Skip]; ok {
-		callSkip = v.(int)
-		delete(fs, caller.Skip)
-	}
-
-	f.PrintCallerInfo(fs, b, callSkip)
+	f.PrintCallerInfo(fs, b, 0)
 
 	w(" : ")
 
-	if fields := fs; len(fields) > 0 {
-		if v, err := json.Marshal(fields); err == nil {
-			b.Write(v)
-			w(" ")
-		}
+	if fields := f.jsonFields(e); len(fields) > 0 {
+		FieldEncoder{}.AppendJSON(b, fields)
+		w(" ")
 	}
 
-	// indent multiple lines log
-	msg := e.Message()
-
-	const pre = "[PRE]"
-	prePos := strings.Index(msg, pre)
-	if prePos < 0 {
-		msg = strings.TrimRight(msg, "\r\n")
-		msg = strings.ReplaceAll(msg, "\n", `\n`)
-		msg = strings.ReplaceAll(msg, "\r", `\r`)
-	} else {
-		msg = msg[:prePos] + msg[prePos+len(pre):]
-	}
-	w(msg)
+	f.Multiline.writeEntry(b, e)
 	w("\n")
 
 	return b.Bytes()
 }
 
-func (f Formatter) PrintCallerInfo(fs Fields, b *bytes.Buffer, callSkip int) {
-	var call *stack.Call
-	if v, ok := fs[caller.CallerKey]; ok {
-		call = v.(*stack.Call)
-		delete(fs, caller.CallerKey)
+// jsonFields returns the visible fields to print as JSON, with the stack key if required.
+func (f Formatter) jsonFields(e Entry) Fields {
+	fields := visibleFields(e.Fields())
+	if f.Stack == nil {
+		return fields
 	}
 
-	if call != nil {
-		f := call.Frame()
-		fileLine := fmt.Sprintf("%s %s:%d", filepath.Base(f.Function), filepath.Base(f.File), f.Line)
-		b.WriteString(fmt.Sprintf("%-20s", fileLine))
-		return
+	ss := f.Stack.Strings(e)
+	if len(ss) == 0 {
+		return fields
 	}
 
-	if !f.PrintCaller || callSkip < 0 {
+	m := make(Fields, len(fields)+1)
+	for k, v := range fields {
+		m[k] = v
+	}
+	m["stack"] = ss
+	return m
+}
+
+// StackLevel returns the lowest level to print the stack by the Stack or the %stack in the Layout,
+// and whether to print any, which tells the Hook to capture the stack for.
+func (f Formatter) StackLevel() (level logrus.Level, ok bool) {
+	if f.Stack != nil {
+		level, ok = f.Stack.Level, true
+	}
+	if f.Layout != nil {
+		if l, has := stackLevel(GroupPart(f.Layout.Parts)); has && (!ok || l > level) {
+			level, ok = l, true
+		}
+	}
+
+	return level, ok
+}
+
+// PrintCallerInfo prints the caller when PrintCaller is true or the caller is recorded in the fields,
+// callSkip is the number of frames to skip above the detected caller.
+func (f Formatter) PrintCallerInfo(fs Fields, b *bytes.Buffer, callSkip int) {
+	if _, recorded := fs[caller.CallerKey]; !recorded && !f.PrintCaller {
 		return
 	}
-	if callSkip == 0 {
-		callSkip = 12
+
+	frame := entryFrame(EntryItem{EntryFields: fs}, callSkip)
+	if frame == nil {
+		return
 	}
 
-	c := stack.Caller(callSkip)
-	cf := c.Frame()
-	fileLine := fmt.Sprintf("%s %s:%d", filepath.Base(cf.Function), filepath.Base(cf.File), cf.Line)
+	buf := str.GetBytesBuffer()
+	defer str.PutBytesBuffer(buf)
+
+	f.Caller.Append(buf, frame)
 	// 参考电子书（写给大家看的设计书 第四版）：http://www.downcc.com/soft/1300.html
 	// 统一对齐方向，全局左对齐，左侧阅读更适合现代人阅读惯性
-	b.WriteString(fmt.Sprintf("%-20s", fileLine))
+	Width{Min: 20, LeftAlign: true}.Write(b, buf.Bytes())
 }
 
 func (f Formatter) PrintLevel(b *bytes.Buffer, level string) {
@@ -200,6 +259,10 @@ const (
 )
 
 func ColorByLevel(level string) int {
+	if l, ok := LookupLevel(level); ok && l.Color > 0 {
+		return l.Color
+	}
+
 	switch level {
 	case "DEBUG", "TRACE":
 		return gray
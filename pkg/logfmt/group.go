@@ -0,0 +1,227 @@
+package logfmt
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/bingoohuang/golog/pkg/str"
+)
+
+// GroupPart is a list of parts, like the (...) in %color{red}(%level %msg).
+type GroupPart []Part
+
+func (g GroupPart) Append(b *bytes.Buffer, e Entry) {
+	for _, p := range g {
+		p.Append(b, e)
+	}
+}
+
+func (g GroupPart) ResetForLogFile() Part {
+	ps := make(GroupPart, len(g))
+	for i, p := range g {
+		ps[i] = resetForLogFile(p)
+	}
+
+	return ps
+}
+
+// ColorPart prints the group in the ANSI color, like %color{red}(%msg) or %color{bold,yellow}(%msg).
+type ColorPart struct {
+	Color string
+	Group GroupPart
+}
+
+func (p ColorPart) Append(b *bytes.Buffer, e Entry) {
+	b.WriteString("\x1b[" + p.Color + "m")
+	p.Group.Append(b, e)
+	b.WriteString("\x1b[0m")
+}
+
+// ResetForLogFile strips the color for the log file.
+func (p ColorPart) ResetForLogFile() Part { return p.Group.ResetForLogFile() }
+
+// HighlightPart prints the group in the color by the level of the entry, like %highlight(%level %msg).
+type HighlightPart struct {
+	Group GroupPart
+}
+
+func (p HighlightPart) Append(b *bytes.Buffer, e Entry) {
+	_, _ = fmt.Fprintf(b, "\x1b[%dm", ColorByLevel(strings.ToUpper(str.Or(e.Level(), "info"))))
+	p.Group.Append(b, e)
+	b.WriteString("\x1b[0m")
+}
+
+// ResetForLogFile strips the color for the log file.
+func (p HighlightPart) ResetForLogFile() Part { return p.Group.ResetForLogFile() }
+
+// IfPart prints the group only when the condition part outputs something, like %if{fields}( %fields).
+type IfPart struct {
+	Cond  Part
+	Group GroupPart
+}
+
+func (p IfPart) Append(b *bytes.Buffer, e Entry) {
+	buf := str.GetBytesBuffer()
+	defer str.PutBytesBuffer(buf)
+
+	if p.Cond.Append(buf, e); !isEmptyOutput(buf.Bytes()) {
+		p.Group.Append(b, e)
+	}
+}
+
+func (p IfPart) ResetForLogFile() Part {
+	p.Group = p.Group.ResetForLogFile().(GroupPart)
+	return p
+}
+
+// OmitEmptyPart prints nothing, including the surrounding brackets, when the part outputs nothing,
+// like [%trace{omitEmpty}] to avoid the [] in the log.
+type OmitEmptyPart struct {
+	Part
+	Prefix string
+	Suffix string
+}
+
+func (p OmitEmptyPart) Append(b *bytes.Buffer, e Entry) {
+	buf := str.GetBytesBuffer()
+	defer str.PutBytesBuffer(buf)
+
+	if p.Part.Append(buf, e); !isEmptyOutput(buf.Bytes()) {
+		b.WriteString(p.Prefix)
+		b.Write(buf.Bytes())
+		b.WriteString(p.Suffix)
+	}
+}
+
+func (p OmitEmptyPart) ResetForLogFile() Part {
+	p.Part = resetForLogFile(p.Part)
+	return p
+}
+
+// isEmptyOutput tells whether the part outputs nothing but spaces, the parts print nothing for the absent values,
+// while a real value like the message - is kept.
+func isEmptyOutput(s []byte) bool {
+	return len(bytes.TrimSpace(s)) == 0
+}
+
+var closeBrackets = map[byte]byte{'[': ']', '(': ')', '{': '}', '<': '>'}
+
+// foldOmitEmpty moves the brackets surrounding the omitEmpty parts into them.
+func (l *Layout) foldOmitEmpty() {
+	for i, p := range l.Parts {
+		oe, ok := p.(OmitEmptyPart)
+		if !ok || i == 0 || i == len(l.Parts)-1 {
+			continue
+		}
+
+		prev, ok1 := l.Parts[i-1].(LiteralPart)
+		next, ok2 := l.Parts[i+1].(LiteralPart)
+		if !ok1 || !ok2 || prev == "" || next == "" {
+			continue
+		}
+
+		opening := prev[len(prev)-1]
+		closing, ok := closeBrackets[opening]
+		if !ok || next[0] != closing {
+			continue
+		}
+
+		prev, next = prev[:len(prev)-1], next[1:]
+		oe.Prefix, oe.Suffix = string(opening), string(closing)
+
+		// take the following space also to avoid double spaces like "a  b" when omitted.
+		if strings.HasPrefix(string(next), " ") && (prev == "" || strings.HasSuffix(string(prev), " ")) {
+			oe.Suffix += " "
+			next = next[1:]
+		}
+
+		l.Parts[i-1], l.Parts[i], l.Parts[i+1] = prev, oe, next
+	}
+}
+
+func isGroupIndicator(indicator string) bool {
+	return str.AnyOf(indicator, "color", "highlight", "if")
+}
+
+// parseGroup parses the group expression in the parentheses, like (%level %msg).
+func parseGroup(layout string) (string, string, error) {
+	if !strings.HasPrefix(layout, "(") {
+		return "", "", fmt.Errorf("bad layout, group expected after %.10s", layout)
+	}
+
+	depth := 0
+	for i := 0; i < len(layout); i++ {
+		switch layout[i] {
+		case '%': // skip the escaped %%
+			if i+1 < len(layout) && layout[i+1] == '%' {
+				i++
+			}
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return layout[i+1:], layout[1:i], nil
+			}
+		}
+	}
+
+	return "", "", fmt.Errorf("bad layout, unclosed parenthesis")
+}
+
+func (lo Option) createGroupPart(indicator, options, expr string) (Part, error) {
+	sub := lo
+	sub.Layout = expr
+	l, err := NewLayout(sub)
+	if err != nil {
+		return nil, err
+	}
+
+	group := GroupPart(l.Parts)
+
+	switch indicator {
+	case "color":
+		color, err := parseColor(options)
+		if err != nil {
+			return nil, err
+		}
+		return ColorPart{Color: color, Group: group}, nil
+	case "highlight":
+		return HighlightPart{Group: group}, nil
+	default: // "if"
+		cond, err := lo.createPart(strings.TrimSpace(options), false, "", "")
+		if err != nil {
+			return nil, fmt.Errorf("bad condition of %%if{%s}: %w", options, err)
+		}
+		return IfPart{Cond: cond, Group: group}, nil
+	}
+}
+
+var colorCodes = map[string]int{
+	"bold": 1, "faint": 2, "italic": 3, "underline": 4, "blink": 5, "reverse": 7,
+	"black": 30, "red": 31, "green": 32, "yellow": 33, "blue": 34, "magenta": 35, "cyan": 36, "white": 37,
+	"gray": 90, "grey": 90,
+}
+
+// parseColor parses the color options like red, bold,red or 31;1 to the SGR parameters.
+func parseColor(options string) (string, error) {
+	var codes []string
+	for _, f := range splitOptions(options) {
+		for _, c := range strings.Split(f, ";") {
+			if _, err := strconv.Atoi(c); err == nil {
+				codes = append(codes, c)
+			} else if v, ok := colorCodes[strings.ToLower(c)]; ok {
+				codes = append(codes, strconv.Itoa(v))
+			} else {
+				return "", fmt.Errorf("unknown color %s", c)
+			}
+		}
+	}
+
+	if len(codes) == 0 {
+		return "", fmt.Errorf("color required for %%color")
+	}
+
+	return strings.Join(codes, ";"), nil
+}
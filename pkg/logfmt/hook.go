@@ -2,26 +2,58 @@ package logfmt
 
 import (
 	"log"
+	"time"
 
 	"github.com/bingoohuang/golog/pkg/rotate"
+	"github.com/bingoohuang/golog/pkg/stack"
 	"github.com/sirupsen/logrus"
 )
 
 // Hook is a hook to handle writing to local log files.
 type Hook struct {
 	Writers []*rotate.WriterFormatter
+	// Dedup collapses the duplicate messages if not nil.
+	Dedup *Dedup
+	// CaptureStack tells whether to capture the stack for the entries of StackLevel and above,
+	// when the formatters print the stack, see Formatter.StackLevel.
+	CaptureStack bool
+	StackLevel   logrus.Level
 }
 
 // NewHook returns new LFS hook.
 // Output can be a string, io.Writer, WriterMap or PathMap.
 // If using io.Writer or WriterMap, user is responsible for closing the used io.Writer.
 func NewHook(writers []*rotate.WriterFormatter) *Hook {
-	return &Hook{Writers: writers}
+	hook := &Hook{Writers: writers}
+	for _, w := range writers {
+		if f, ok := w.Formatter.(interface{ StackLevel() (logrus.Level, bool) }); ok {
+			if l, has := f.StackLevel(); has && (!hook.CaptureStack || l > hook.StackLevel) {
+				hook.CaptureStack, hook.StackLevel = true, l
+			}
+		}
+	}
+
+	return hook
 }
 
 // Fire writes the log file to defined path or using the defined writer.
 // User who run this function needs write permissions to the file or directory if the file does not yet exist.
 func (hook *Hook) Fire(entry *logrus.Entry) error {
+	message, ok := hook.limit(entry)
+	if !ok {
+		return nil
+	}
+	entry.Message = message
+
+	if entry.Data == nil {
+		entry.Data = logrus.Fields{}
+	}
+	entry.Data[SeqKey] = nextSeq()
+	if _, ok := entry.Data[StackKey]; !ok && hook.CaptureStack && entry.Level <= hook.StackLevel {
+		entry.Data[StackKey] = stack.Trace()
+	}
+
+	levelName, _ := entry.Data[LevelKey].(string)
 	for _, writer := range hook.Writers {
 		msg, err := writer.Formatter.Format(entry)
 		if err != nil {
@@ -33,13 +65,56 @@ func (hook *Hook) Fire(entry *logrus.Entry) error {
 			continue
 		}
 
-		if _, err := writer.Write(entry.Level, msg); err != nil {
+		if _, err := rotate.WriteLevelName(writer.LevelWriter, entry.Level, levelName, msg); err != nil {
 			return err
 		}
 	}
 
+	if entry.Level <= logrus.FatalLevel { // flush the async writers before the exit or panic
+		hook.Flush()
+	}
+
 	return nil
 }
 
+// Flush waits until the entries queued by the async writers are written.
+func (hook *Hook) Flush() {
+	for _, writer := range hook.Writers {
+		if f, ok := writer.LevelWriter.(interface{ Flush() }); ok {
+			f.Flush()
+		}
+	}
+}
+
+// async tells whether any writer queues the entries to write asynchronously.
+func (hook *Hook) async() bool {
+	for _, writer := range hook.Writers {
+		if _, ok := writer.LevelWriter.(interface{ Flush() }); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// limit tells whether the entry is allowed by the limit conf in its fields, or else by the dedup,
+// and returns its message annotated with the number of the suppressed ones.
+func (hook *Hook) limit(entry *logrus.Entry) (string, bool) {
+	if _, ok := entry.Data[limitedKey]; ok {
+		return entry.Message, true
+	}
+
+	if confStr, ok := entry.Data[LimitKey].(string); ok {
+		msg := []byte(entry.Message)
+		if conf := parseLimitConf(confStr, msg); conf != nil {
+			// the pending one is logged with the fields of the entry, at the time of emission
+			name, _ := entry.Data[LevelKey].(string)
+			s, limited := limitBy(conf, entry.WithTime(time.Time{}), entry.Level, name, msg, nil)
+			return string(s), !limited
+		}
+	}
+
+	return hook.Dedup.allow(entry)
+}
+
 // Levels returns configured log levels.
 func (hook *Hook) Levels() []logrus.Level { return logrus.AllLevels }
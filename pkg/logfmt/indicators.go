@@ -0,0 +1,161 @@
+package logfmt
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bingoohuang/golog/pkg/str"
+	"github.com/bingoohuang/golog/pkg/timex"
+)
+
+var (
+	// Hostname is the host name reported by the kernel.
+	Hostname, _ = os.Hostname()
+	// StartTime is the time when the process started, used by %elapsed.
+	StartTime = time.Now()
+
+	seq uint64
+)
+
+func nextSeq() uint64 { return atomic.AddUint64(&seq, 1) }
+
+// HostPart prints the host name, like %host.
+type HostPart struct{}
+
+func (HostPart) Append(b *bytes.Buffer, _ Entry) { b.WriteString(Hostname) }
+
+// AppPart prints the binary name of the application, like %app.
+type AppPart struct{}
+
+func (AppPart) Append(b *bytes.Buffer, _ Entry) { b.WriteString(AppName) }
+
+// GoVersionPart prints the go version of the binary, like %goversion.
+type GoVersionPart struct{}
+
+func (GoVersionPart) Append(b *bytes.Buffer, _ Entry) { b.WriteString(runtime.Version()) }
+
+// SeqPart prints the monotonic per-process sequence number of the entry, like %seq.
+type SeqPart struct{}
+
+func (SeqPart) Append(b *bytes.Buffer, e Entry) {
+	n, ok := e.Fields()[SeqKey].(uint64)
+	if !ok {
+		n = nextSeq()
+	}
+
+	b.WriteString(strconv.FormatUint(n, 10))
+}
+
+// ElapsedPart prints the elapsed time since the process started, like %elapsed or %elapsed{ms}.
+type ElapsedPart struct {
+	Millis bool
+}
+
+func (p ElapsedPart) Append(b *bytes.Buffer, e Entry) {
+	d := timex.OrNow(e.Time()).Sub(StartTime)
+	if p.Millis {
+		b.WriteString(strconv.FormatInt(d.Milliseconds(), 10))
+	} else {
+		b.WriteString(d.Truncate(time.Millisecond).String())
+	}
+}
+
+func parseElapsed(options string) (Part, error) {
+	_, ms := parseOptionMap(options)["ms"]
+	return ElapsedPart{Millis: ms}, nil
+}
+
+// EnvPart prints the environment variable, like %env{NAME} or %env{name=NAME}.
+type EnvPart struct {
+	Name string
+}
+
+func (p EnvPart) Append(b *bytes.Buffer, _ Entry) { b.WriteString(os.Getenv(p.Name)) }
+
+func parseEnv(options string) (Part, error) {
+	name := optionName(options)
+	if name == "" {
+		return nil, errors.New("name required for %env")
+	}
+
+	return EnvPart{Name: name}, nil
+}
+
+// FieldPart prints a single field value, like %field{name=userId} or %field{userId}.
+type FieldPart struct {
+	Name    string
+	Encoder FieldEncoder
+}
+
+func (p FieldPart) Append(b *bytes.Buffer, e Entry) {
+	fs := e.Fields()
+	v, ok := fs[p.Name]
+	if !ok {
+		return
+	}
+
+	buf := str.GetBytesBuffer()
+	defer str.PutBytesBuffer(buf)
+
+	p.Encoder.AppendText(buf, v)
+	b.WriteString(sanitizeText(fs, buf.String()))
+}
+
+func (lo Option) parseField(options string) (Part, error) {
+	name := optionName(options)
+	if name == "" {
+		return nil, errors.New("name required for %field")
+	}
+
+	return FieldPart{Name: name, Encoder: lo.fieldEncoder}, nil
+}
+
+// optionName returns the name=xxx option, or the first option without = when name is absent.
+func optionName(options string) string {
+	m := parseOptionMap(options)
+	if v := m["name"]; v != "" {
+		return v
+	}
+
+	for _, f := range splitOptions(options) {
+		if !strings.Contains(f, "=") {
+			return f
+		}
+	}
+
+	return ""
+}
+
+// FuncPart prints the function name of the caller, like %func.
+type FuncPart struct{}
+
+func (FuncPart) Append(b *bytes.Buffer, e Entry) {
+	if f := entryFrame(e, 0); f != nil {
+		b.WriteString(filepath.Base(f.Function))
+	}
+}
+
+// FilePart prints the file name of the caller, like %file.
+type FilePart struct{}
+
+func (FilePart) Append(b *bytes.Buffer, e Entry) {
+	if f := entryFrame(e, 0); f != nil {
+		b.WriteString(filepath.Base(f.File))
+	}
+}
+
+// LinePart prints the line number of the caller, like %line.
+type LinePart struct{}
+
+func (LinePart) Append(b *bytes.Buffer, e Entry) {
+	if f := entryFrame(e, 0); f != nil {
+		b.WriteString(strconv.Itoa(f.Line))
+	}
+}
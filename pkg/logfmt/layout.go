@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
@@ -13,9 +13,7 @@ import (
 	"github.com/bingoohuang/golog/pkg/caller"
 	"github.com/bingoohuang/golog/pkg/gid"
 	"github.com/bingoohuang/golog/pkg/logctx"
-	"github.com/bingoohuang/golog/pkg/spec"
 	"github.com/bingoohuang/golog/pkg/str"
-	"github.com/bingoohuang/golog/pkg/timex"
 	"github.com/sirupsen/logrus"
 )
 
@@ -27,16 +25,20 @@ type Layout struct {
 func (l *Layout) ResetForLogFile() *Layout {
 	ps := make([]Part, len(l.Parts))
 	for i, p := range l.Parts {
-		if v, ok := p.(LogFileReset); ok {
-			ps[i] = v.ResetForLogFile()
-		} else {
-			ps[i] = p
-		}
+		ps[i] = resetForLogFile(p)
 	}
 
 	return &Layout{Parts: ps}
 }
 
+func resetForLogFile(p Part) Part {
+	if v, ok := p.(LogFileReset); ok {
+		return v.ResetForLogFile()
+	}
+
+	return p
+}
+
 func (l Layout) Append(b *bytes.Buffer, e Entry) {
 	for _, p := range l.Parts {
 		p.Append(b, e)
@@ -67,6 +69,11 @@ func (l *Layout) addPart(p Part) {
 
 // NewLayout creates a new layout from string expression.
 func NewLayout(lo Option) (*Layout, error) {
+	if lo.fieldEncoder.Time == nil {
+		t := findTime(lo.Layout)
+		lo.fieldEncoder.Time = &t
+	}
+
 	l := &Layout{}
 	percentPos := 0
 	layout := lo.Layout
@@ -107,14 +114,33 @@ func NewLayout(lo Option) (*Layout, error) {
 			return nil, err
 		}
 
-		p, err := lo.createPart(indicator, minus, digits, options)
+		var p Part
+		omitEmpty := false
+		if isGroupIndicator(indicator) {
+			group := ""
+			if layout, group, err = parseGroup(layout); err != nil {
+				return nil, err
+			}
+			p, err = lo.createGroupPart(indicator, options, group)
+		} else {
+			options, omitEmpty = cutOptionFlag(options, "omitEmpty")
+			p, err = lo.createPart(indicator, minus, digits, options)
+		}
 		if err != nil {
 			return nil, err
 		}
 
+		if w := parseWidth(minus, digits); !w.IsZero() {
+			p = WidthPart{Part: p, Width: w}
+		}
+		if omitEmpty {
+			p = OmitEmptyPart{Part: p}
+		}
+
 		l.addPart(p)
 	}
 
+	l.foldOmitEmpty()
 	return l, nil
 }
 
@@ -135,11 +161,33 @@ func (lo Option) createPart(indicator string, minus bool, digits, options string
 	case "caller":
 		return parseCaller(minus, digits, options)
 	case "fields":
-		return parseFields(minus, digits, options)
+		return lo.parseFields(minus, digits, options)
 	case "message", "msg", "m":
-		return parseMessage(minus, digits, options)
+		return lo.parseMessage(minus, digits, options)
 	case "n":
 		return parseNewLine(minus, digits, options)
+	case "host":
+		return HostPart{}, nil
+	case "app":
+		return AppPart{}, nil
+	case "seq":
+		return SeqPart{}, nil
+	case "elapsed":
+		return parseElapsed(options)
+	case "env":
+		return parseEnv(options)
+	case "field":
+		return lo.parseField(options)
+	case "func":
+		return FuncPart{}, nil
+	case "file":
+		return FilePart{}, nil
+	case "line":
+		return LinePart{}, nil
+	case "stack":
+		return parseStack(minus, digits, options)
+	case "goversion":
+		return GoVersionPart{}, nil
 	}
 
 	return nil, fmt.Errorf("unknown indicator %s", indicator)
@@ -156,75 +204,172 @@ func parseNewLine(minus bool, digits string, options string) (Part, error) {
 }
 
 type MessagePart struct {
-	SingleLine bool
+	Multiline Multiline
 }
 
 func (p MessagePart) Append(b *bytes.Buffer, e Entry) {
-	// indent multiple lines log
-	msg := e.Message()
-	msg = strings.TrimRight(msg, "\r\n")
+	p.Multiline.writeEntry(b, e)
+}
 
-	if p.SingleLine {
-		// indent multiple lines log
-		b.WriteString(strings.ReplaceAll(msg, "\n", `\n`))
-	} else {
-		b.WriteString(msg)
+// parseMessage parses the options like %msg{multiline=indent,prefix='| '}, singleLine=false is same as multiline=raw.
+func (lo Option) parseMessage(minus bool, digits string, options string) (Part, error) {
+	m := parseOptionMap(options)
+	mode := str.Or(m["multiline"], lo.Multiline)
+	if v, ok := m["singleline"]; ok && m["multiline"] == "" {
+		if mode = "escape"; !str.ParseBool(v, true) {
+			mode = "raw"
+		}
 	}
+
+	ml, err := ParseMultiline(mode, str.Or(m["prefix"], lo.MultilinePrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	return MessagePart{Multiline: ml}, nil
 }
 
-func parseMessage(minus bool, digits string, options string) (Part, error) {
-	p := MessagePart{SingleLine: true}
+// FieldsPart prints the visible fields, like %fields{order=insertion,include=userId,orderId,*,exclude=password,style=kv}.
+type FieldsPart struct {
+	Encoder FieldEncoder
+	// Order is sorted (default) or insertion, which follows the order recorded by WithOrderedFields.
+	Order string
+	// Include is the keys to print in order, the * in it stands for all the other keys.
+	Include []string
+	// Exclude is the keys not to print.
+	Exclude []string
+	// Style is json (default), kv like a=1 b=2, or pretty for the indented JSON.
+	Style string
+}
 
-	fields := strings.FieldsFunc(options, func(c rune) bool {
-		return unicode.IsSpace(c) || c == ','
-	})
+func (p FieldsPart) Append(b *bytes.Buffer, e Entry) {
+	fs := e.Fields()
+	keys := p.keys(fs)
+	if len(keys) == 0 {
+		return
+	}
 
-	for _, f := range fields {
-		parts := strings.SplitN(f, "=", 2)
-		k := ""
-		v := ""
-		if len(parts) > 0 {
-			k = strings.ToLower(parts[0])
+	switch p.Style {
+	case "kv":
+		p.Encoder.AppendKV(b, fs, keys)
+	case "pretty":
+		buf := str.GetBytesBuffer()
+		defer str.PutBytesBuffer(buf)
+
+		p.Encoder.AppendOrderedJSON(buf, fs, keys)
+		_ = json.Indent(b, buf.Bytes(), "", "  ")
+	default:
+		p.Encoder.AppendOrderedJSON(b, fs, keys)
+	}
+}
+
+// keys returns the keys of the fields to print in order.
+func (p FieldsPart) keys(fs Fields) []string {
+	var rest []string
+	if len(p.Include) == 0 || str.AnyOf("*", p.Include...) {
+		rest = p.orderedKeys(fs)
+	}
+
+	if len(p.Include) == 0 {
+		return p.excluded(rest)
+	}
+
+	included := make(map[string]bool, len(p.Include))
+	for _, k := range p.Include {
+		included[k] = true
+	}
+
+	keys := make([]string, 0, len(fs))
+	for _, k := range p.Include {
+		if k != "*" {
+			if _, ok := fs[k]; ok {
+				keys = append(keys, k)
+			}
+			continue
 		}
 
-		if len(parts) > 1 {
-			v = parts[1]
+		for _, r := range rest {
+			if !included[r] {
+				keys = append(keys, r)
+			}
 		}
+	}
+
+	return p.excluded(keys)
+}
 
-		if k == "singleline" {
-			p.SingleLine = str.ParseBool(v, true)
+// orderedKeys returns the visible keys in the order.
+func (p FieldsPart) orderedKeys(fs Fields) []string {
+	keys := make([]string, 0, len(fs))
+	seen := map[string]bool{}
+	if p.Order == "insertion" {
+		order, _ := fs[FieldsOrderKey].([]string)
+		for _, k := range order {
+			if _, ok := fs[k]; ok && !seen[k] {
+				keys = append(keys, k)
+				seen[k] = true
+			}
 		}
+	}
 
+	ordered := len(keys)
+	for k := range fs {
+		if !isInternalKey(k) && !seen[k] {
+			keys = append(keys, k)
+		}
 	}
-	return p, nil
+
+	// the keys not recorded in the insertion order are sorted after the recorded ones.
+	sort.Strings(keys[ordered:])
+	return keys
 }
 
-type FieldsPart struct{}
+func (p FieldsPart) excluded(keys []string) []string {
+	if len(p.Exclude) == 0 {
+		return keys
+	}
 
-func (p FieldsPart) Append(b *bytes.Buffer, e Entry) {
-	if fields := e.Fields(); len(fields) > 0 {
-		if v, err := json.Marshal(fields); err == nil {
-			b.Write(v)
+	kept := keys[:0]
+	for _, k := range keys {
+		if !str.AnyOf(k, p.Exclude...) {
+			kept = append(kept, k)
 		}
 	}
+
+	return kept
 }
 
-func parseFields(minus bool, digits string, options string) (Part, error) {
-	return FieldsPart{}, nil
+func (lo Option) parseFields(minus bool, digits string, options string) (Part, error) {
+	m, lists := parseOptionLists(options, "include", "exclude")
+	p := FieldsPart{
+		Encoder: lo.fieldEncoder,
+		Order:   strings.ToLower(str.Or(m["order"], "sorted")),
+		Include: lists["include"],
+		Exclude: lists["exclude"],
+		Style:   strings.ToLower(str.Or(m["style"], "json")),
+	}
+
+	if !str.AnyOf(p.Order, "sorted", "insertion") {
+		return nil, fmt.Errorf("unknown order %s of %%fields", p.Order)
+	}
+	if !str.AnyOf(p.Style, "json", "kv", "pretty") {
+		return nil, fmt.Errorf("unknown style %s of %%fields", p.Style)
+	}
+
+	return p, nil
 }
 
 type ContextPart struct {
-	Name   string
-	Digits string
+	Name string
 }
 
 func (p ContextPart) Append(b *bytes.Buffer, e Entry) {
 	v, _ := logctx.Get(p.Name)
-	b.WriteString(fmt.Sprintf("%"+p.Digits+"s", v))
+	b.WriteString(v)
 }
 
 func parseContext(minus bool, digits string, options string) (Part, error) {
-	c := ContextPart{Digits: compositeDigits(minus, digits, "")}
+	c := ContextPart{}
 
 	fields := strings.FieldsFunc(options, func(c rune) bool {
 		return unicode.IsSpace(c) || c == ','
@@ -255,107 +400,93 @@ func parseContext(minus bool, digits string, options string) (Part, error) {
 	return c, nil
 }
 
+// CallerPart prints the caller, like %caller{level=info,path=relative,func=pkg,sep=:,skip=1,depth=3}.
 type CallerPart struct {
-	Digits string
-	Sep    string
-	skip   int
-	Level  logrus.Level
+	CallerFormat
+	// Level is the lowest level to print the caller, default warn.
+	Level logrus.Level
+	// Skip is the number of frames to skip above the detected caller, like in the logging wrappers.
+	Skip int
+	// Depth is the number of frames to print, each in a new line when it is greater than 1.
+	Depth int
 }
 
 func (p CallerPart) Append(b *bytes.Buffer, e Entry) {
-	ll, _ := logrus.ParseLevel(e.Level())
+	ll := parseLevelName(e.Level())
 	if ll > p.Level {
 		return
 	}
 
-	fileLine := "-"
-	callSkip := p.skip
-	if v, ok := e.Fields()[caller.Skip]; ok {
-		callSkip = v.(int)
-		delete(e.Fields(), caller.Skip)
+	if p.Depth <= 1 {
+		if f := entryFrame(e, p.Skip); f != nil {
+			p.CallerFormat.Append(b, f)
+		}
+		return
 	}
 
-	for i := 0; i < callSkip; i++ {
-		if c := caller.GetCaller(i, "github.com/sirupsen/logrus"); c != nil {
-			fileLine = fmt.Sprintf("\n%d%s%s %s%s%d ", i+1, p.Sep, filepath.Base(c.Function), filepath.Base(c.File), p.Sep, c.Line)
-			b.WriteString(fmt.Sprintf("%"+p.Digits+"s", fileLine))
-		}
+	for i, f := range caller.DetectN(p.Skip, p.Depth) {
+		b.WriteString("\n" + strconv.Itoa(i+1) + " ")
+		p.CallerFormat.Append(b, &f)
 	}
 }
 
 func parseCaller(minus bool, digits string, options string) (Part, error) {
-	c := CallerPart{Digits: compositeDigits(minus, digits, "")}
-
-	fields := strings.FieldsFunc(options, func(c rune) bool {
-		return unicode.IsSpace(c) || c == ','
-	})
-
-	level := ""
-
-	for _, f := range fields {
-		parts := strings.SplitN(f, "=", 2)
-		k, v := "", ""
-		if len(parts) > 0 {
-			k = strings.ToLower(parts[0])
-		}
-		if len(parts) > 1 {
-			v = parts[1]
-		}
-
-		switch k {
-		case "level":
-			level = v
-		case "sep":
-			c.Sep = v
-		case "skip":
-			c.skip, _ = strconv.Atoi(v)
-		}
+	m := parseOptionMap(options)
+	c := CallerPart{
+		CallerFormat: parseCallerFormat(m),
+		Skip:         str.ParseInt(m["skip"], 0),
+		Depth:        str.ParseInt(m["depth"], 1),
 	}
 
-	c.Level, _ = logrus.ParseLevel(str.Or(level, "warn"))
-	c.Sep = str.Or(c.Sep, ":")
+	level, err := logrus.ParseLevel(str.Or(m["level"], "warn"))
+	if err != nil {
+		return nil, err
+	}
+	c.Level = level
 
 	return c, nil
 }
 
-type TracePart struct {
-	Digits string
-}
+type TracePart struct{}
 
 func (t TracePart) Append(b *bytes.Buffer, e Entry) {
-	b.WriteString(fmt.Sprintf("%"+t.Digits+"s", e.TraceID()))
+	b.WriteString(e.TraceID())
 }
 
 func parseTrace(minus bool, digits string, options string) (Part, error) {
-	return TracePart{Digits: compositeDigits(minus, digits, "")}, nil
+	return TracePart{}, nil
 }
 
-type GidPart struct {
-	Digits string
-}
+type GidPart struct{}
 
 func (p GidPart) Append(b *bytes.Buffer, e Entry) {
-	b.WriteString(fmt.Sprintf("%"+p.Digits+"s", gid.CurGoroutineID()))
+	b.WriteString(string(entryGid(e.Fields())))
 }
 
-func parseGid(minus bool, digits string, options string) (Part, error) {
-	return GidPart{Digits: compositeDigits(minus, digits, "")}, nil
+// entryGid returns the goroutine ID recorded in the caller.GidKey field, or the current one.
+func entryGid(fs Fields) gid.GoroutineID {
+	if v, ok := fs[caller.GidKey].(gid.GoroutineID); ok {
+		return v
+	}
+
+	return gid.CurGoroutineID()
 }
 
-type PidPart struct {
-	Digits string
+func parseGid(minus bool, digits string, options string) (Part, error) {
+	return GidPart{}, nil
 }
 
+type PidPart struct{}
+
 func (p PidPart) Append(b *bytes.Buffer, e Entry) {
-	b.WriteString(fmt.Sprintf("%d", Pid))
+	b.WriteString(strconv.Itoa(Pid))
 }
 
 func parsePid(minus bool, digits string, options string) (Part, error) {
-	return PidPart{Digits: compositeDigits(minus, digits, "")}, nil
+	return PidPart{}, nil
 }
 
 type LevelPart struct {
-	Digits     string
 	PrintColor bool
 	LowerCase  bool
 	Length     int
@@ -385,7 +516,7 @@ func (l LevelPart) Append(b *bytes.Buffer, e Entry) {
 		lvl = strings.ToLower(lvl)
 	}
 
-	b.WriteString(fmt.Sprintf("%"+l.Digits+"s", lvl))
+	b.WriteString(lvl)
 
 	if l.PrintColor { // reset
 		b.WriteString("\x1b[0m")
@@ -393,7 +524,7 @@ func (l LevelPart) Append(b *bytes.Buffer, e Entry) {
 }
 
 func (lo Option) parseLevel(minus bool, digits string, options string) (Part, error) {
-	l := LevelPart{Digits: compositeDigits(minus, digits, "5"), PrintColor: lo.PrintColor}
+	l := LevelPart{PrintColor: lo.PrintColor}
 
 	fields := strings.FieldsFunc(options, func(c rune) bool {
 		return unicode.IsSpace(c) || c == ','
@@ -421,31 +552,11 @@ func (lo Option) parseLevel(minus bool, digits string, options string) (Part, er
 		}
 	}
 
-	return l, nil
-}
-
-func compositeDigits(minus bool, digits, defaultValue string) string {
-	if digits == "" && defaultValue != "" {
-		digits = defaultValue
+	if digits == "" { // level is right justified in 5 columns by default
+		return WidthPart{Part: l, Width: Width{Min: 5, LeftAlign: minus}}, nil
 	}
 
-	if minus {
-		digits = "-" + digits
-	}
-
-	return digits
-}
-
-type Time struct {
-	Format string
-}
-
-func (t Time) Append(b *bytes.Buffer, e Entry) {
-	b.WriteString(timex.OrNow(e.Time()).Format(t.Format))
-}
-
-func parseTime(minus bool, digits string, options string) (Part, error) {
-	return Time{Format: spec.ConvertTimeLayout(str.Or(options, "2006-01-02 15:04:05.000"))}, nil
+	return l, nil
 }
 
 func parseMinus(layout string) (string, bool) {
@@ -456,13 +567,14 @@ func parseMinus(layout string) (string, bool) {
 	return layout, false
 }
 
+// parseDigits parses the width modifier digits like 20, 20.30 or 20.-30.
 func parseDigits(layout string) (string, string) {
 	digits := ""
 	j := 0
 
 	for i, r := range layout {
 		j = i
-		if unicode.IsDigit(r) || r == '.' {
+		if unicode.IsDigit(r) || r == '.' || r == '-' && strings.HasSuffix(digits, ".") {
 			digits += string(r)
 			j++
 		} else {
@@ -2,9 +2,21 @@ package logfmt
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/bingoohuang/golog/pkg/caller"
+	"github.com/bingoohuang/golog/pkg/redact"
+	"github.com/bingoohuang/golog/pkg/stack"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,3 +29,460 @@ func TestTimeLayout(t *testing.T) {
 	})
 	t.Log(b.String())
 }
+
+func TestWidthModifier(t *testing.T) {
+	cases := []struct {
+		layout, msg, expected string
+	}{
+		{layout: "[%10msg]", msg: "hello", expected: "[     hello]"},
+		{layout: "[%-10msg]", msg: "hello", expected: "[hello     ]"},
+		{layout: "[%.3msg]", msg: "hello", expected: "[llo]"},
+		{layout: "[%.-3msg]", msg: "hello", expected: "[hel]"},
+		{layout: "[%-6.8msg]", msg: "hello world", expected: "[lo world]"},
+		{layout: "[%-6.-8msg]", msg: "hello world", expected: "[hello wo]"},
+		{layout: "[%-6msg]", msg: "中文", expected: "[中文  ]"},
+		{layout: "[%.-3msg]", msg: "中文字", expected: "[中]"},
+		{layout: "[%.-3msg]", msg: "中文a", expected: "[中]"},
+		{layout: "[%5l]", msg: "", expected: "[ INFO]"},
+		{layout: "[%-5l]", msg: "", expected: "[INFO ]"},
+		{layout: "[%l]", msg: "", expected: "[ INFO]"},
+		{layout: "[%.-2l]", msg: "", expected: "[IN]"},
+	}
+
+	for _, c := range cases {
+		l, err := NewLayout(Option{Layout: c.layout})
+		assert.Nil(t, err)
+		var b bytes.Buffer
+		l.Append(&b, EntryItem{EntryMessage: c.msg, EntryLevel: "info"})
+		assert.Equal(t, c.expected, b.String(), c.layout)
+	}
+}
+
+func TestWidthModifierColor(t *testing.T) {
+	l, err := NewLayout(Option{Layout: "[%-7l]", PrintColor: true})
+	assert.Nil(t, err)
+	var b bytes.Buffer
+	l.Append(&b, EntryItem{EntryLevel: "warning"})
+	assert.Equal(t, "[\x1b[33mWARN\x1b[0m   ]", b.String())
+}
+
+func TestGroupLayout(t *testing.T) {
+	cases := []struct {
+		layout   string
+		entry    EntryItem
+		expected string
+		file     string
+	}{
+		{
+			layout:   "%color{red}(%msg)",
+			entry:    EntryItem{EntryMessage: "hello"},
+			expected: "\x1b[31mhello\x1b[0m", file: "hello",
+		},
+		{
+			layout:   "%color{bold,yellow}([%-5l]) %msg",
+			entry:    EntryItem{EntryMessage: "hello", EntryLevel: "info"},
+			expected: "\x1b[1;33m[INFO ]\x1b[0m hello", file: "[INFO ] hello",
+		},
+		{
+			layout:   "%highlight(%l %msg)",
+			entry:    EntryItem{EntryMessage: "hello", EntryLevel: "error"},
+			expected: "\x1b[31mERROR hello\x1b[0m", file: "ERROR hello",
+		},
+		{
+			layout:   "%msg%if{fields}( %fields)",
+			entry:    EntryItem{EntryMessage: "hello"},
+			expected: "hello", file: "hello",
+		},
+		{
+			layout:   "%msg%if{fields}( %fields)",
+			entry:    EntryItem{EntryMessage: "hello", EntryFields: Fields{"a": 1}},
+			expected: `hello {"a":1}`, file: `hello {"a":1}`,
+		},
+		{
+			layout:   "%if{msg}([%msg])",
+			entry:    EntryItem{EntryMessage: "-"},
+			expected: "[-]", file: "[-]",
+		},
+		{
+			layout:   "a [%msg{omitEmpty}] b",
+			entry:    EntryItem{EntryMessage: "-"},
+			expected: "a [-] b", file: "a [-] b",
+		},
+		{
+			layout:   "%msg%if{fields}(%%(%fields))",
+			entry:    EntryItem{EntryMessage: "hello", EntryFields: Fields{"a": 1}},
+			expected: `hello%({"a":1})`, file: `hello%({"a":1})`,
+		},
+		{
+			layout:   "a [%trace{omitEmpty}] b",
+			entry:    EntryItem{},
+			expected: "a b", file: "a b",
+		},
+		{
+			layout:   "a [%trace{omitEmpty}] b",
+			entry:    EntryItem{EntryTraceID: "t1"},
+			expected: "a [t1] b", file: "a [t1] b",
+		},
+		{
+			layout:   "a[%trace{omitEmpty}]",
+			entry:    EntryItem{},
+			expected: "a", file: "a",
+		},
+	}
+
+	for _, c := range cases {
+		l, err := NewLayout(Option{Layout: c.layout})
+		assert.Nil(t, err)
+		var b bytes.Buffer
+		l.Append(&b, c.entry)
+		assert.Equal(t, c.expected, b.String(), c.layout)
+
+		b.Reset()
+		l.ResetForLogFile().Append(&b, c.entry)
+		assert.Equal(t, c.file, b.String(), c.layout)
+	}
+
+	_, err := NewLayout(Option{Layout: "%color{red}%msg"})
+	assert.NotNil(t, err)
+	_, err = NewLayout(Option{Layout: "%color{red}(%msg"})
+	assert.NotNil(t, err)
+	_, err = NewLayout(Option{Layout: "%color{purple}(%msg)"})
+	assert.NotNil(t, err)
+}
+
+func TestMoreIndicators(t *testing.T) {
+	_ = os.Setenv("GOLOG_TEST_ENV", "env1")
+	call := stack.Caller(0)
+	e := EntryItem{
+		EntryTime:   StartTime.Add(1500 * time.Millisecond),
+		EntryFields: Fields{"userId": 100, caller.CallerKey: &call, SeqKey: uint64(7)},
+	}
+
+	cases := map[string]string{
+		"%host":                 Hostname,
+		"%app":                  AppName,
+		"%seq":                  "7",
+		"%elapsed":              "1.5s",
+		"%elapsed{ms}":          "1500",
+		"%env{GOLOG_TEST_ENV}":  "env1",
+		"%field{name=userId}":   "100",
+		"[%-5field{userId}]":    "[100  ]",
+		"%func %file:%line":     "logfmt.TestMoreIndicators layout_test.go:" + strconv.Itoa(call.Frame().Line),
+		"%goversion":            runtime.Version(),
+		"[%field{name=absent}]": "[]",
+	}
+
+	for layout, expected := range cases {
+		l, err := NewLayout(Option{Layout: layout})
+		assert.Nil(t, err)
+		var b bytes.Buffer
+		l.Append(&b, e)
+		assert.Equal(t, expected, b.String(), layout)
+	}
+
+	_, err := NewLayout(Option{Layout: "%env"})
+	assert.NotNil(t, err)
+	_, err = NewLayout(Option{Layout: "%field{}"})
+	assert.NotNil(t, err)
+}
+
+type userID int
+
+func (u userID) String() string { return "U" + strconv.Itoa(int(u)) }
+
+func TestFieldEncoder(t *testing.T) {
+	cause := errors.New("boom")
+	tm := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.Local)
+	e := EntryItem{EntryTime: tm, EntryFields: Fields{
+		"err":   pkgerrors.Wrap(fmt.Errorf("db: %w", cause), "query"),
+		"join":  errors.Join(errors.New("a"), errors.New("b")),
+		"cost":  1500 * time.Millisecond,
+		"at":    tm,
+		"user":  userID(7),
+		"text":  []byte("hello"),
+		"bin":   []byte{0, 1, 2},
+		"plain": errors.New("plain"),
+	}}
+
+	cases := map[string]string{
+		"%field{err}":             "query: db: boom",
+		"%field{join}":            "a\nb",
+		"%field{cost}":            "1.5s",
+		"%field{at}":              "2024-01-02 03:04:05.006",
+		"%t{HH:mm:ss} %field{at}": "03:04:05 03:04:05",
+		"%field{user}":            "U7",
+		"%field{text}":            "hello",
+		"%field{bin}":             "AAEC",
+		"%fields": `{"at":"2024-01-02 03:04:05.006","bin":"AAEC","cost":"1.5s",` +
+			`"err":{"causes":["db: boom","boom"],"message":"query: db: boom"},"join":{"causes":["a","b"],"message":"a\nb"},` +
+			`"plain":"plain","text":"hello","user":"U7"}`,
+	}
+
+	for layout, expected := range cases {
+		l, err := NewLayout(Option{Layout: layout})
+		assert.Nil(t, err)
+		var b bytes.Buffer
+		l.Append(&b, e)
+		assert.Equal(t, expected, b.String(), layout)
+	}
+
+	var b bytes.Buffer
+	FieldEncoder{}.AppendText(&b, pkgerrors.WithMessage(io.EOF, "read"))
+	assert.Equal(t, "read: EOF", b.String())
+
+	b.Reset()
+	FieldEncoder{}.AppendText(&b, &wrapped{msg: "failed", cause: io.EOF})
+	assert.Equal(t, "failed; caused by: EOF", b.String())
+}
+
+type wrapped struct {
+	msg   string
+	cause error
+}
+
+func (w *wrapped) Error() string { return w.msg }
+func (w *wrapped) Unwrap() error { return w.cause }
+
+func TestFieldsOptions(t *testing.T) {
+	e := EntryItem{EntryFields: Fields{
+		"b": 2, "a": "x y", "c": 3, "password": "secret", SeqKey: uint64(1),
+		FieldsOrderKey: []string{"c", "a", "b", "c"},
+	}}
+
+	cases := map[string]string{
+		"%fields":                                 `{"a":"x y","b":2,"c":3,"password":"secret"}`,
+		"%fields{order=insertion}":                `{"c":3,"a":"x y","b":2,"password":"secret"}`,
+		"%fields{include=b,a}":                    `{"b":2,"a":"x y"}`,
+		"%fields{include=b,*,exclude=password,c}": `{"b":2,"a":"x y"}`,
+		"%fields{exclude=password,style=kv}":      `a="x y" b=2 c=3`,
+		"%fields{include=b,style=pretty}":         "{\n  \"b\": 2\n}",
+		"[%fields{include=absent,omitEmpty}]":     "",
+	}
+
+	for layout, expected := range cases {
+		l, err := NewLayout(Option{Layout: layout})
+		assert.Nil(t, err)
+		var b bytes.Buffer
+		l.Append(&b, e)
+		assert.Equal(t, expected, b.String(), layout)
+	}
+
+	_, err := NewLayout(Option{Layout: "%fields{style=xml}"})
+	assert.NotNil(t, err)
+}
+
+func TestWithOrderedFields(t *testing.T) {
+	e := WithOrderedFields(logrus.New(), "z", 1, "y", 2)
+	e2 := WithOrderedFields(e, "x", 3)
+	_ = WithOrderedFields(e, "w", 4)
+
+	l, err := NewLayout(Option{Layout: "%fields{order=insertion}"})
+	assert.Nil(t, err)
+	var b bytes.Buffer
+	l.Append(&b, EntryItem{EntryFields: Fields(e2.Data)})
+	assert.Equal(t, `{"z":1,"y":2,"x":3}`, b.String())
+}
+
+func TestRedact(t *testing.T) {
+	r, err := redact.New("mobile|password:drop|idCard:hash")
+	assert.Nil(t, err)
+
+	l, err := NewLayout(Option{Layout: "%msg %fields"})
+	assert.Nil(t, err)
+	f := Formatter{Layout: l, Redactor: r}
+	e := EntryItem{
+		EntryMessage: "call 13800138000",
+		EntryFields: Fields{
+			"password": "s3cret",
+			"err":      errors.New("bad user 13900139000"),
+			"id":       "11010519491231002X",
+			"count":    1,
+		},
+	}
+
+	hash := redact.Rule{Action: redact.Hash}.Value("11010519491231002X")
+	assert.Equal(t, `call 138****8000 {"count":1,"err":"bad user 139****9000","id":"`+hash+`"}`, string(f.Format(e)))
+
+	type login struct {
+		User     string
+		Password string
+		Mobile   string
+	}
+	e.EntryFields = Fields{
+		"login": &login{User: "bingoo", Password: "s3cret", Mobile: "13800138000"},
+		"plain": struct{ Z, A string }{Z: "z", A: "a"},
+		"meta":  map[string]interface{}{"pwd": 123, "n": 1},
+	}
+	assert.Equal(t, `call 138****8000 {"login":{"Mobile":"138****8000","User":"bingoo"},"meta":{"n":1},`+
+		`"plain":{"Z":"z","A":"a"}}`, string(f.Format(e)))
+}
+
+func TestSanitize(t *testing.T) {
+	cases := map[string]string{
+		"plain 中文":             "plain 中文",
+		"a\tb\nc":              `a	b\nc`,
+		"\x1b[31mred\x1b[0m":   `\x1b[31mred\x1b[0m`,
+		"fake\r2024 [INFO] ok": `fake\r2024 [INFO] ok`,
+		"bad\xff\x00utf8":      `bad\xff\x00utf8`,
+		"c1\u0085ls\u2028":     `c1\u0085ls\u2028`,
+	}
+	for s, expected := range cases {
+		assert.Equal(t, expected, Sanitize(s, false), s)
+	}
+	assert.Equal(t, "a\nb", Sanitize("a\nb", true))
+
+	l, err := NewLayout(Option{Layout: "%msg{singleLine=false} %fields"})
+	assert.Nil(t, err)
+	f := Formatter{Layout: l, Sanitize: true}
+
+	e := EntryItem{EntryMessage: "line1\nline2\x1b[2J\r\n", EntryFields: Fields{"name": "a\nb"}}
+	// the JSON fields are escaped only once by the JSON encoding
+	assert.Equal(t, "line1\nline2\\x1b[2J {\"name\":\"a\\nb\"}", string(f.Format(e)))
+
+	e.EntryFields[RawKey] = true
+	assert.Equal(t, "line1\nline2\x1b[2J {\"name\":\"a\\nb\"}", string(f.Format(e)))
+
+	// the text renderings of the fields are escaped
+	l, err = NewLayout(Option{Layout: "%field{name} %fields{style=kv}"})
+	assert.Nil(t, err)
+	f = Formatter{Layout: l, Sanitize: true}
+	e = EntryItem{EntryFields: Fields{"name": "a\n\x1b[2Jb", "k\r": 1}}
+	assert.Equal(t, `a\n\x1b[2Jb k\r=1 name=a\n\x1b[2Jb`, string(f.Format(e)))
+
+	// the fake log line after the [PRE] marker in the user data is not written raw
+	l, err = NewLayout(Option{Layout: "%msg"})
+	assert.Nil(t, err)
+	f = Formatter{Layout: l, Sanitize: true}
+	e = EntryItem{EntryMessage: "[PRE]x\n2026-01-01 00:00:00 [ERROR] fake\n"}
+	assert.Equal(t, "x\n  2026-01-01 00:00:00 [ERROR] fake", string(f.Format(e)))
+	e = EntryItem{EntryMessage: "x [PRE]\n2026-01-01 00:00:00 [ERROR] fake"}
+	assert.Equal(t, `x [PRE]\n2026-01-01 00:00:00 [ERROR] fake`, string(f.Format(e)))
+	f.Sanitize = false
+	e = EntryItem{EntryMessage: "[PRE]a\n  b\n"}
+	assert.Equal(t, "a\n  b\n", string(f.Format(e)))
+}
+
+func TestMaxEntrySize(t *testing.T) {
+	assert.Equal(t, "abc", Truncate("abc", 3))
+	assert.Equal(t, "aa…[truncated 28 bytes]", Truncate(strings.Repeat("a", 30), 25))
+	assert.Equal(t, "中…[truncated 27 bytes]", Truncate(strings.Repeat("中", 10), 27))
+	// only the marker is left when the max is less than it
+	assert.Equal(t, "…[truncated 3 bytes]", Truncate("abc", 2))
+
+	l, err := NewLayout(Option{Layout: "%msg %fields"})
+	assert.Nil(t, err)
+	f := Formatter{Layout: l, MaxEntrySize: 80}
+
+	before := GetMetrics()
+	e := EntryItem{EntryMessage: "0123456789", EntryFields: Fields{"id": "ab", "body": strings.Repeat("x", 200), "n": 1}}
+	// the body is truncated to the share of 68 bytes, the marker included
+	body := strings.Repeat("x", 44) + "…[truncated 156 bytes]"
+	assert.Equal(t, `0123456789 {"body":"`+body+`","id":"ab","n":1}`, string(f.Format(e)))
+	assert.Equal(t, 80, len("0123456789"+"ab"+body))
+
+	after := GetMetrics()
+	assert.Equal(t, uint64(1), after.Truncations-before.Truncations)
+	assert.Equal(t, uint64(156), after.TruncatedBytes-before.TruncatedBytes)
+
+	f.SkipMetrics = true
+	f.Format(e)
+	assert.Equal(t, after, GetMetrics())
+
+	e = EntryItem{EntryMessage: strings.Repeat("m", 60), EntryFields: Fields{"body": strings.Repeat("x", 60)}}
+	assert.Equal(t, strings.Repeat("m", 17)+`…[truncated 43 bytes] {"body":"`+strings.Repeat("x", 17)+`…[truncated 43 bytes]"}`,
+		string(f.Format(e)))
+
+	// the giant struct dump is truncated by its JSON encoding
+	type dump struct{ Data string }
+	f = Formatter{Layout: l, MaxEntrySize: 100}
+	e = EntryItem{EntryMessage: "dump", EntryFields: Fields{"dump": dump{Data: strings.Repeat("x", 5000)}}}
+	out := string(f.Format(e))
+	assert.True(t, strings.HasPrefix(out, `dump {"dump":"{\"Data\":\"xxx`), out)
+	assert.True(t, strings.HasSuffix(out, `…[truncated 4940 bytes]"}`), out)
+	e = EntryItem{EntryMessage: "dump", EntryFields: Fields{"dump": dump{Data: "small"}}}
+	assert.Equal(t, `dump {"dump":{"Data":"small"}}`, string(f.Format(e)))
+}
+
+func TestMaxEntrySizeSetup(t *testing.T) {
+	stdout := os.Stdout
+	os.Stdout, _ = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	t.Cleanup(func() { os.Stdout = stdout })
+
+	ll := logrus.New()
+	Option{Stdout: true, LogPath: t.TempDir() + "/a.log", Layout: "%msg%n", MaxEntrySize: 50}.Setup(ll)
+
+	before := GetMetrics()
+	ll.Info(strings.Repeat("x", 100))
+	after := GetMetrics()
+	// counted once for both the stdout and the log file
+	assert.Equal(t, uint64(1), after.Truncations-before.Truncations)
+}
+
+func TestMultiline(t *testing.T) {
+	e := EntryItem{EntryMessage: "select *\r\nfrom t\nwhere a = 1\n"}
+	cases := map[string]string{
+		"%msg":                               `select *\r\nfrom t\nwhere a = 1`,
+		"%msg{singleLine=false}":             "select *\r\nfrom t\nwhere a = 1",
+		"%msg{multiline=indent}":             "select *\n  from t\n  where a = 1",
+		"%msg{multiline=indent,prefix='| '}": "select *\n| from t\n| where a = 1",
+		"%msg{multiline=raw}":                "select *\r\nfrom t\nwhere a = 1",
+	}
+
+	for layout, expected := range cases {
+		l, err := NewLayout(Option{Layout: layout})
+		assert.Nil(t, err)
+		var b bytes.Buffer
+		l.Append(&b, e)
+		assert.Equal(t, expected, b.String(), layout)
+	}
+
+	l, err := NewLayout(Option{Layout: "%msg", Multiline: "indent", MultilinePrefix: "> "})
+	assert.Nil(t, err)
+	var b bytes.Buffer
+	l.Append(&b, EntryItem{EntryMessage: "a\nb"})
+	assert.Equal(t, "a\n> b", b.String())
+
+	b.Reset()
+	l.Append(&b, EntryItem{EntryMessage: "[PRE]a\n  b\n"})
+	assert.Equal(t, "a\n  b\n", b.String())
+
+	_, err = NewLayout(Option{Layout: "%msg{multiline=fold}"})
+	assert.NotNil(t, err)
+
+	f := Formatter{Simple: true, Multiline: Multiline{Mode: "indent"}}
+	out := string(f.Format(EntryItem{EntryMessage: "a\nb"}))
+	assert.True(t, strings.HasSuffix(out, " : a\n  b\n"), out)
+}
+
+func TestTimeOptions(t *testing.T) {
+	tm := time.Date(2024, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	e := EntryItem{EntryTime: tm, EntryFields: Fields{"at": tm}}
+
+	cases := map[string]string{
+		"%t":               "2024-01-02 03:04:05.006",
+		"%t{HH:mm:ss,SSS}": "03:04:05,006",
+		"%t{layout=HH:mm:ss,SSS,tz=Asia/Shanghai}":  "11:04:05,006",
+		"%t{tz=UTC,layout=ISO8601}":                 "2024-01-02T03:04:05.006Z",
+		"%t{RFC3339Nano}":                           "2024-01-02T03:04:05.006Z",
+		"%t{unix}":                                  "1704164645",
+		"%t{unixms}":                                "1704164645006",
+		"%t{unixnano}":                              "1704164645006000000",
+		"%t{%Y-%m-%d %H:%M:%S.%L}":                  "2024-01-02 03:04:05.006",
+		"%t{strftime=%H:%M,tz=Asia/Shanghai}":       "11:04",
+		"%t{tz=Asia/Shanghai,layout=HH} %field{at}": "11 11",
+		"%t{yyyy-MM-dd'T'HH:mm:ss.SSSXXX}":          "2024-01-02T03:04:05.006Z",
+		"%t{EEE, dd MMM yyyy h:mm a}":               "Tue, 02 Jan 2024 3:04 AM",
+		"%t{'at' yyyyMMdd 'o''clock'}":              "at 20240102 o'clock",
+	}
+
+	for layout, expected := range cases {
+		l, err := NewLayout(Option{Layout: layout})
+		assert.Nil(t, err, layout)
+		var b bytes.Buffer
+		l.Append(&b, e)
+		assert.Equal(t, expected, b.String(), layout)
+	}
+
+	_, err := NewLayout(Option{Layout: "%t{tz=Mars/Base}"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,153 @@
+package logfmt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LevelKeyMatch defines where the level key is matched in the message.
+type LevelKeyMatch int
+
+const (
+	// MatchPrefix matches the key at the beginning of the message, the leading spaces ignored.
+	// Like MatchToken, the key like level=warn does not match level=warning.
+	MatchPrefix LevelKeyMatch = iota
+	// MatchToken matches the key as a whole token anywhere, like [WARN] in "order 100 [WARN] timeout",
+	// or level=warn in "ts=1 level=warn msg=timeout" but not in "level=warning".
+	MatchToken
+	// MatchAnywhere matches the key anywhere in the message, even inside a word.
+	MatchAnywhere
+)
+
+// LevelKeyConf defines a customized level key in the std log message, like [DEBUG] for debugging level.
+type LevelKeyConf struct {
+	// Key is the text to match, like [DEBUG] or level=debug.
+	Key string
+	// Level is the logrus level of the key.
+	Level logrus.Level
+	// Custom is the name of the custom level like NOTICE, which takes precedence over Level.
+	Custom string
+	// Match is where to match the key, default MatchPrefix.
+	Match LevelKeyMatch
+	// IgnoreCase matches the key case-insensitively.
+	IgnoreCase bool
+	// Keep keeps the key in the message, or else it is stripped.
+	Keep bool
+}
+
+// find finds the key in the message, and returns its position, or -1 if not found.
+func (k LevelKeyConf) find(msg []byte) int {
+	if k.Key == "" {
+		return -1
+	}
+
+	if k.Match == MatchPrefix {
+		x := len(msg) - len(bytes.TrimLeft(msg, " \t"))
+		if k.at(msg, x) && k.bounded(msg, x) {
+			return x
+		}
+		return -1
+	}
+
+	for x := 0; x+len(k.Key) <= len(msg); x++ {
+		if k.at(msg, x) && (k.Match == MatchAnywhere || k.bounded(msg, x)) {
+			return x
+		}
+	}
+
+	return -1
+}
+
+// at tells whether the key is at the position x of the message.
+func (k LevelKeyConf) at(msg []byte, x int) bool {
+	if x+len(k.Key) > len(msg) {
+		return false
+	}
+
+	s := string(msg[x : x+len(k.Key)])
+	if k.IgnoreCase {
+		return strings.EqualFold(s, k.Key)
+	}
+
+	return s == k.Key
+}
+
+// bounded tells whether the key at the position x is not adjacent to letters, digits or underscores,
+// on the sides where the key itself begins or ends with them, like \b in the regular expressions.
+func (k LevelKeyConf) bounded(msg []byte, x int) bool {
+	y := x + len(k.Key)
+	return (!isWordByte(k.Key[0]) || x == 0 || !isWordByte(msg[x-1])) &&
+		(!isWordByte(k.Key[len(k.Key)-1]) || y == len(msg) || !isWordByte(msg[y]))
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+var (
+	levelKeysLock sync.Mutex
+	// levelKeys holds the registered []LevelKeyConf in order, copied on write.
+	levelKeys atomic.Value
+)
+
+// RegisterLevelKey customizes the log level key at the beginning of the message,
+// like [DEBUG] for debugging level, which is stripped from the message.
+func RegisterLevelKey(levelKey string, level logrus.Level) {
+	RegisterLevelKeys(LevelKeyConf{Key: levelKey, Level: level})
+}
+
+// RegisterLevelKeys registers the customized level keys, the earlier registered ones take precedence,
+// and the existing one of the same key and match is replaced in place.
+func RegisterLevelKeys(keys ...LevelKeyConf) {
+	levelKeysLock.Lock()
+	defer levelKeysLock.Unlock()
+
+	old, _ := levelKeys.Load().([]LevelKeyConf)
+	ks := append([]LevelKeyConf(nil), old...)
+	for _, k := range keys {
+		replaced := false
+		for i, o := range ks {
+			if o.Key == k.Key && o.Match == k.Match {
+				ks[i], replaced = k, true
+			}
+		}
+		if !replaced {
+			ks = append(ks, k)
+		}
+	}
+
+	levelKeys.Store(ks)
+}
+
+// RegisterLevelNames registers the keys of the level names formatted by the format,
+// like [%s] for [WARN], or level=%s for level=warn, matched case-insensitively.
+// The logrus levels, WARN and the custom levels registered till now are included.
+func RegisterLevelNames(format string, match LevelKeyMatch) {
+	var keys []LevelKeyConf
+	for _, l := range logrus.AllLevels {
+		keys = append(keys, LevelKeyConf{Key: fmt.Sprintf(format, l.String()), Level: l, Match: match, IgnoreCase: true})
+	}
+	keys = append(keys, LevelKeyConf{Key: fmt.Sprintf(format, "warn"), Level: logrus.WarnLevel, Match: match, IgnoreCase: true})
+	for _, l := range loadLevels().levels {
+		keys = append(keys, LevelKeyConf{Key: fmt.Sprintf(format, l.Name), Custom: l.Name, Match: match, IgnoreCase: true})
+	}
+
+	RegisterLevelKeys(keys...)
+}
+
+// findLevelKey finds the first registered level key in the message.
+func findLevelKey(msg []byte) (LevelKeyConf, int) {
+	ks, _ := levelKeys.Load().([]LevelKeyConf)
+	for _, k := range ks {
+		if x := k.find(msg); x >= 0 {
+			return k, x
+		}
+	}
+
+	return LevelKeyConf{}, -1
+}
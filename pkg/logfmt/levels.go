@@ -0,0 +1,160 @@
+package logfmt
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// LevelKey is the key of the name of the custom level, like NOTICE, carried in the entry fields,
+// since logrus only knows its seven levels.
+const LevelKey = "_GologLevel"
+
+// Level defines a custom level beyond the seven ones of logrus.
+type Level struct {
+	// Name is the level name like NOTICE, matched case-insensitively.
+	Name string
+	// Priority sorts the level among the logrus ones (panic 0, fatal 1, error 2, warn 3, info 4, debug 5, trace 6),
+	// the smaller the more severe, e.g. 3.5 for the level between warn and info.
+	Priority float64
+	// Tag is the level tag in the std log message, like N!.
+	Tag string
+	// Color is the ANSI color code to print the level, like 32 for green.
+	Color int
+	// Bypass logs the level regardless of the level threshold of the logger, like for the audit logs.
+	Bypass bool
+}
+
+// Logrus returns the logrus level to log by, the nearest one not more severe,
+// so that the level is enabled only when the threshold covers its priority.
+func (l Level) Logrus() logrus.Level {
+	return logrus.Level(math.Ceil(l.Priority))
+}
+
+// levelRegistry is the snapshot of the registered custom levels.
+type levelRegistry struct {
+	levels []Level
+	// tagRe matches the tags of the logrus levels and the custom ones.
+	tagRe *regexp.Regexp
+}
+
+var (
+	levelsLock sync.Mutex
+	// levels holds the *levelRegistry, copied on write.
+	levels atomic.Value
+)
+
+func init() {
+	RegisterLevel(
+		Level{Name: "NOTICE", Priority: 3.5, Tag: "N!", Color: 32},
+		Level{Name: "AUDIT", Priority: 3.4, Tag: "A!", Color: 35, Bypass: true},
+	)
+}
+
+// RegisterLevel registers the custom levels, the existing one of the same name is replaced.
+func RegisterLevel(ls ...Level) {
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+
+	var all []Level
+	if r, ok := levels.Load().(*levelRegistry); ok {
+		for _, l := range r.levels {
+			if findLevel(ls, l.Name) < 0 {
+				all = append(all, l)
+			}
+		}
+	}
+	all = append(all, ls...)
+	sort.SliceStable(all, func(i, j int) bool { return all[i].Priority < all[j].Priority })
+
+	var tags []string
+	for _, l := range all {
+		if l.Tag != "" {
+			tags = append(tags, regexp.QuoteMeta(l.Tag))
+		}
+	}
+	// the longer tags first, so that the custom tags like AUD! are not shadowed by D!
+	sort.SliceStable(tags, func(i, j int) bool { return len(tags[i]) > len(tags[j]) })
+	tags = append(tags, `[TDIWEFP]!`)
+
+	levels.Store(&levelRegistry{levels: all, tagRe: regexp.MustCompile(`\b(?:` + strings.Join(tags, "|") + `)`)})
+}
+
+func findLevel(ls []Level, name string) int {
+	for i, l := range ls {
+		if strings.EqualFold(l.Name, name) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func loadLevels() *levelRegistry {
+	return levels.Load().(*levelRegistry)
+}
+
+// LookupLevel looks up the custom level by the name.
+func LookupLevel(name string) (Level, bool) {
+	r := loadLevels()
+	if i := findLevel(r.levels, name); i >= 0 {
+		return r.levels[i], true
+	}
+
+	return Level{}, false
+}
+
+// lookupLevelTag looks up the custom level by the tag.
+func lookupLevelTag(tag string) (Level, bool) {
+	for _, l := range loadLevels().levels {
+		if l.Tag == tag {
+			return l, true
+		}
+	}
+
+	return Level{}, false
+}
+
+// LogLevel logs the message at the custom level of the name, like LogLevel(logrus.StandardLogger(), "NOTICE", "hello").
+// The unknown level names are logged at the info level.
+func LogLevel(l FieldsWither, name string, args ...interface{}) {
+	lv, ok := LookupLevel(name)
+	if !ok {
+		l.WithFields(nil).Info(args...)
+		return
+	}
+
+	e := l.WithFields(logrus.Fields{LevelKey: lv.Name})
+	level := lv.Logrus()
+	if e.Logger.IsLevelEnabled(level) {
+		e.Log(level, args...)
+		return
+	}
+
+	if lv.Bypass { // fire the hooks directly, where golog writes the logs, to bypass the threshold
+		e.Time = time.Now()
+		e.Level = level
+		e.Message = fmt.Sprint(args...)
+		if err := e.Logger.Hooks.Fire(level, e); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to fire hook: %v\n", err)
+		}
+	}
+}
+
+// parseLevelName parses the level name of the entry to the logrus level, the custom ones included.
+func parseLevelName(name string) logrus.Level {
+	if lv, ok := LookupLevel(name); ok {
+		return lv.Logrus()
+	}
+
+	l, _ := logrus.ParseLevel(name)
+	return l
+}
@@ -0,0 +1,124 @@
+package logfmt_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bingoohuang/golog/pkg/logfmt"
+	"github.com/bingoohuang/golog/pkg/rotate"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomLevels(t *testing.T) {
+	logfmt.RestoreLevels(t)
+
+	var buf bytes.Buffer
+	layout, err := logfmt.NewLayout(logfmt.Option{Layout: "%l{length=6} %msg%n"})
+	assert.Nil(t, err)
+
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.AddHook(logfmt.NewHook([]*rotate.WriterFormatter{{
+		LevelWriter: rotate.WrapLevelWriter(&buf),
+		Formatter:   &logfmt.LogrusFormatter{Formatter: logfmt.Formatter{Layout: layout}},
+	}}))
+
+	logfmt.LogLevel(ll, "notice", "hello")
+	logfmt.LogLevel(ll, "AUDIT", "login")
+	assert.Equal(t, "NOTICE hello\nAUDIT login\n", buf.String())
+
+	buf.Reset()
+	ll.SetLevel(logrus.WarnLevel)
+	logfmt.LogLevel(ll, "NOTICE", "filtered")
+	logfmt.LogLevel(ll, "AUDIT", "bypassed")
+	assert.Equal(t, "AUDIT bypassed\n", buf.String())
+
+	level, s, ok := logfmt.ParseLevelFromMsg([]byte("N! hello"))
+	assert.Equal(t, logrus.InfoLevel, level)
+	assert.Equal(t, "hello", string(s))
+	assert.True(t, ok)
+
+	logfmt.RegisterLevel(logfmt.Level{Name: "SECURITY", Priority: 2.5, Tag: "SEC!", Color: 31})
+	level, s, ok = logfmt.ParseLevelFromMsg([]byte("SEC! attack"))
+	assert.Equal(t, logrus.WarnLevel, level)
+	assert.Equal(t, "attack", string(s))
+	assert.True(t, ok)
+	assert.Equal(t, 31, logfmt.ColorByLevel("SECURITY"))
+}
+
+// auditRouter routes the AUDIT entries to the audit buffer, and the others to the main one.
+type auditRouter struct {
+	main, audit bytes.Buffer
+}
+
+func (r *auditRouter) Write(_ logrus.Level, p []byte) (int, error) { return r.main.Write(p) }
+
+func (r *auditRouter) WriteLevelName(level logrus.Level, name string, p []byte) (int, error) {
+	if name == "AUDIT" {
+		return r.audit.Write(p)
+	}
+	return r.Write(level, p)
+}
+
+func TestCustomLevelRouting(t *testing.T) {
+	layout, err := logfmt.NewLayout(logfmt.Option{Layout: "%l %msg%n"})
+	assert.Nil(t, err)
+
+	for _, async := range []bool{false, true} {
+		router := &auditRouter{}
+		var w rotate.LevelWriter = router
+		if async {
+			w = rotate.NewAsyncWriter(router, rotate.AsyncOption{})
+		}
+
+		ll := logrus.New()
+		ll.SetOutput(io.Discard)
+		ll.AddHook(logfmt.NewHook([]*rotate.WriterFormatter{{
+			LevelWriter: w,
+			Formatter:   &logfmt.LogrusFormatter{Formatter: logfmt.Formatter{Layout: layout}},
+		}}))
+
+		ll.Info("hello")
+		logfmt.LogLevel(ll, "AUDIT", "login")
+		logfmt.LogLevel(ll, "NOTICE", "notice")
+		if a, ok := w.(*rotate.AsyncWriter); ok {
+			assert.Nil(t, a.Close())
+		}
+
+		assert.Equal(t, " INFO hello\nNOTICE notice\n", router.main.String())
+		assert.Equal(t, "AUDIT login\n", router.audit.String())
+	}
+}
+
+func TestLevelKeys(t *testing.T) {
+	logfmt.RestoreLevels(t)
+
+	logfmt.RegisterLevelKey("[DEBUG]", logrus.DebugLevel)
+	logfmt.RegisterLevelKeys(logfmt.LevelKeyConf{Key: "#audit", Custom: "AUDIT", Match: logfmt.MatchToken, Keep: true})
+	logfmt.RegisterLevelNames("level=%s", logfmt.MatchToken)
+
+	cases := []struct {
+		msg, expected string
+		level         logrus.Level
+		found         bool
+	}{
+		{msg: "[DEBUG] hello", expected: "hello", level: logrus.DebugLevel, found: true},
+		{msg: "  [DEBUG] hello", expected: "hello", level: logrus.DebugLevel, found: true},
+		{msg: "see [DEBUG] below", expected: "see [DEBUG] below", level: logrus.InfoLevel},
+		{msg: "user login #audit", expected: "user login #audit", level: logrus.InfoLevel, found: true},
+		{msg: "user login #auditing", expected: "user login #auditing", level: logrus.InfoLevel},
+		{msg: "ts=1 level=warn msg=timeout", expected: "ts=1 msg=timeout", level: logrus.WarnLevel, found: true},
+		{msg: "ts=1 LEVEL=ERROR msg=timeout", expected: "ts=1 msg=timeout", level: logrus.ErrorLevel, found: true},
+		{msg: "ts=1 level=warning msg=timeout", expected: "ts=1 msg=timeout", level: logrus.WarnLevel, found: true},
+		{msg: "ts=1 loglevel=warn", expected: "ts=1 loglevel=warn", level: logrus.InfoLevel},
+	}
+
+	for _, c := range cases {
+		level, s, found := logfmt.ParseLevelFromMsg([]byte(c.msg))
+		assert.Equal(t, c.level, level, c.msg)
+		assert.Equal(t, c.expected, string(s), c.msg)
+		assert.Equal(t, c.found, found, c.msg)
+	}
+}
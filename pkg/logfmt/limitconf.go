@@ -2,15 +2,20 @@ package logfmt
 
 import (
 	"bytes"
+	"math"
+	"math/rand"
 	"regexp"
+	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"unicode"
 
 	"github.com/bingoohuang/golog/pkg/caller"
 	"github.com/bingoohuang/golog/pkg/gid"
-	"github.com/bingoohuang/golog/pkg/stack"
+	"github.com/bingoohuang/golog/pkg/rotate"
+	"github.com/bingoohuang/golog/pkg/str"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,112 +27,463 @@ var (
 	// [L:100,0s]  to limit 1 message every 100 messages with the first two words in the message as key
 	// [L:15s]      to limit 1 message every 15 seconds with the first two words in the message as key
 	// [L:LimitConf1]      to limit using configuration whose name is LimitConf1
-	reglimitTip = regexp.MustCompile(`\[L:[\w\d-.:,\s]+]`)               // https://regex101.com/r/LTjduP/4
+	// [L:tb=10/s,burst=20:key]  token bucket of 10 messages per second with the burst of 20
+	// [L:first=5/s,thereafter=100:key]  sampling of the first 5 messages per second, then every 100th
+	// [L:p=0.1:key]  probabilistic sampling of 10% messages
+	reglimitTip = regexp.MustCompile(`\[L:[\w\d-.:,=/\s]+]`)             // https://regex101.com/r/LTjduP/4
 	reglimitSep = regexp.MustCompile(`(\d+,)?(\d+\w{0,2})(:[\w\d-.]+)?`) // https://regex101.com/r/kfQJrN/3
 )
 
+// LimitConf defines the limit of a key, the strategy is one of the following by the fields set:
+// token bucket by Rate and Burst, sampling by First, Thereafter and Tick, probabilistic sampling by Probability,
+// or else 1 message every EveryNum messages or every EveryTime, with the last suppressed one emitted later.
 type LimitConf struct {
 	Key       string
 	EveryNum  int
 	EveryTime time.Duration
 	Level     logrus.Level
+
+	// Rate is the number of tokens per second refilled into the token bucket.
+	Rate float64
+	// Burst is the capacity of the token bucket, default 1.
+	Burst int
+	// First is the number of messages allowed per Tick, and then every Thereafter-th message is allowed.
+	First      int
+	Thereafter int
+	// Tick is the window of sampling, default 1s.
+	Tick time.Duration
+	// Probability is the probability in (0, 1] to allow a message.
+	Probability float64
+}
+
+// deferred tells whether the limit is the one of every N messages or every T, which emits the suppressed message later.
+func (c LimitConf) deferred() bool {
+	return c.Rate <= 0 && c.First <= 0 && c.Thereafter <= 0 && c.Probability <= 0
+}
+
+// countOnly tells whether the limit is only by the count of the messages, like every N messages or every N-th one
+// thereafter, which has no time to emit the summary, so the summary is emitted after the key is idle.
+func (c LimitConf) countOnly() bool {
+	return c.EveryTime <= 0 && c.Rate <= 0 && c.First <= 0 && c.Probability <= 0
+}
+
+// LimitKey is the key of the limit conf carried in the entry fields for the logrus callers, like the xyz in [L:xyz]
+// of the std log messages, the name of the registered one, or the inline one like 100,15s:key or tb=10/s,burst=20:key.
+const LimitKey = "_GologLimit"
+
+// limitedKey marks the entry emitted by the limiter, which is not limited again.
+const limitedKey = "_GologLimited"
+
+// WithLimit adds the limit conf to the logger, like WithLimit(logrus.StandardLogger(), "db.slow").Warnf("slow query").
+func WithLimit(l FieldsWither, conf string) *logrus.Entry {
+	return l.WithFields(logrus.Fields{LimitKey: conf})
 }
 
 type limitRuntime struct {
 	conf        *LimitConf
-	ll          *logrus.Logger
-	call        *stack.Call
+	ll          FieldsWither
+	call        *runtime.Frame
 	goroutineID gid.GoroutineID
 	msg         []byte
 	num         int
 	sync.Mutex
 	level logrus.Level
+	// name is the name of the custom level of the pending msg, like NOTICE.
+	name string
+
+	// suppressed is the number of the messages dropped since the last emitted one,
+	// excluding the pending msg to emit later.
+	suppressed int
+	// timer emits the pending msg when no message is allowed in time.
+	timer *time.Timer
+	// idleTimeout is the time after the last message to emit the pending msg of the count only limits.
+	idleTimeout time.Duration
+	// lastEmit is the time of the last emitted message, lastSeen is the time of the last message.
+	lastEmit, lastSeen time.Time
+
+	// tokens and last are the state of the token bucket.
+	tokens float64
+	last   time.Time
+	// window and count are the state of the sampling.
+	window time.Time
+	count  int
 }
 
-func (r *limitRuntime) run() {
-	if r.conf.EveryTime == 0 {
-		return
+// Allow tells whether the message is allowed by the limit.
+// The allowed message is annotated with the number of the suppressed ones before it,
+// and the last dropped one is emitted later by ll, the logger or the entry with fields, if no message is allowed in the window,
+// at the custom level of the name if not empty.
+func (r *limitRuntime) Allow(ll FieldsWither, level logrus.Level, name string, msg []byte, formatter *LogrusFormatter) ([]byte, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	now := time.Now()
+	r.lastSeen = now
+	if r.allow(now) {
+		r.lastEmit = now
+		r.stopTimer()
+		return withSuppressed(msg, r.takeSuppressed()), true
 	}
 
-	ticker := time.NewTicker(r.conf.EveryTime)
-	for {
-		r.sendMsg()
-		<-ticker.C
+	r.store(ll, level, name, msg, formatter)
+	if r.timer == nil {
+		r.timer = time.AfterFunc(r.emitDelay(now), r.sendMsg)
 	}
+
+	return nil, false
 }
 
-func (r *limitRuntime) SendNewMsg(ll *logrus.Logger, level logrus.Level, msg []byte, formatter *LogrusFormatter) {
-	r.Lock()
-	defer r.Unlock()
+// emitDelay returns the delay to try to emit the pending msg, when the strategy may allow a message next.
+func (r *limitRuntime) emitDelay(now time.Time) time.Duration {
+	c := r.conf
+	var delay time.Duration
+	switch {
+	case c.countOnly():
+		delay = r.idleTimeout - now.Sub(r.lastSeen)
+	case c.deferred():
+		delay = c.EveryTime - now.Sub(r.lastEmit)
+	case c.Rate > 0: // till the next token
+		tokens := math.Min(r.burst(), r.tokens+now.Sub(r.last).Seconds()*c.Rate)
+		delay = time.Duration((1 - tokens) / c.Rate * float64(time.Second))
+	case c.First > 0: // till the next window
+		delay = r.window.Add(c.tick()).Sub(now)
+	default:
+		delay = c.tick()
+	}
 
-	if r.conf.EveryNum > 0 {
-		if r.num == r.conf.EveryNum {
-			r.num = 0
-		}
+	if delay < time.Millisecond {
+		delay = time.Millisecond
+	}
+	return delay
+}
 
-		if r.num == 0 {
-			ll.WithField(caller.Skip, 13).Log(level, string(msg))
-			r.msg = nil
-			r.num++
-			return
-		}
+// due tells whether to emit the pending msg now, which takes the budget of the strategy like a message.
+func (r *limitRuntime) due(now time.Time) bool {
+	c := r.conf
+	switch {
+	case c.countOnly():
+		return now.Sub(r.lastSeen) >= r.idleTimeout
+	case c.deferred():
+		return now.Sub(r.lastEmit) >= c.EveryTime
+	default:
+		return r.allow(now)
+	}
+}
+
+func (r *limitRuntime) stopTimer() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
+
+// store stores the limited message to emit later, the replaced one is counted as suppressed.
+func (r *limitRuntime) store(ll FieldsWither, level logrus.Level, name string, msg []byte, formatter *LogrusFormatter) {
+	if r.msg != nil {
+		r.suppress()
 	}
 
-	r.num++
 	r.msg = append([]byte{}, msg...)
-	r.level = level
+	r.level, r.name = level, name
 	r.ll = ll
 	r.goroutineID = gid.CurGoroutineID()
 
-	if formatter.PrintCaller {
-		call := stack.Caller(5)
-		r.call = &call
+	if formatter == nil || formatter.PrintCaller {
+		r.call = caller.Detect(0)
 	}
 }
 
+func (r *limitRuntime) suppress() {
+	r.suppressed++
+	metrics.suppressed.Add(1)
+}
+
+// takeSuppressed discards the pending msg as suppressed, and returns the number of the suppressed messages.
+func (r *limitRuntime) takeSuppressed() int {
+	if r.msg != nil {
+		r.suppress()
+		r.msg = nil
+	}
+
+	n := r.suppressed
+	r.suppressed = 0
+	return n
+}
+
+// withSuppressed appends the number of the suppressed messages like (+5 similar) to the message,
+// before its trailing new lines like the one of log.Printf.
+func withSuppressed(msg []byte, suppressed int) []byte {
+	if suppressed <= 0 {
+		return msg
+	}
+
+	msg = bytes.TrimRight(msg, "\r\n")
+	return append(append([]byte{}, msg...), " (+"+strconv.Itoa(suppressed)+" similar)"...)
+}
+
+// allow tells whether the message is allowed by the strategy of the limit.
+func (r *limitRuntime) allow(now time.Time) bool {
+	c := r.conf
+	switch {
+	case c.deferred():
+		r.num++
+		return c.EveryNum > 0 && (r.num-1)%c.EveryNum == 0 ||
+			c.EveryTime > 0 && now.Sub(r.lastEmit) >= c.EveryTime
+	case c.Rate > 0:
+		burst := r.burst()
+		if r.last.IsZero() {
+			r.tokens = burst
+		} else {
+			r.tokens = math.Min(burst, r.tokens+now.Sub(r.last).Seconds()*c.Rate)
+		}
+		r.last = now
+		if r.tokens < 1 {
+			return false
+		}
+		r.tokens--
+		return true
+	case c.First > 0 || c.Thereafter > 0:
+		if now.Sub(r.window) >= c.tick() {
+			r.window, r.count = now, 0
+		}
+		r.count++
+		if r.count <= c.First {
+			return true
+		}
+		return c.Thereafter > 0 && (r.count-c.First)%c.Thereafter == 0
+	default:
+		return rand.Float64() < c.Probability
+	}
+}
+
+func (r *limitRuntime) burst() float64 {
+	return math.Max(1, float64(r.conf.Burst))
+}
+
+// tick returns the window of sampling, default 1s.
+func (c LimitConf) tick() time.Duration {
+	if c.Tick > 0 {
+		return c.Tick
+	}
+	return time.Second
+}
+
+// sendMsg emits the pending msg, annotated with the number of the suppressed messages before it,
+// if the strategy allows, or else tries again later.
 func (r *limitRuntime) sendMsg() {
 	r.Lock()
 	defer r.Unlock()
 
+	r.timer = nil
+	if r.msg == nil {
+		return
+	}
+
+	if now := time.Now(); !r.due(now) {
+		r.timer = time.AfterFunc(r.emitDelay(now), r.sendMsg)
+		return
+	}
+
+	r.flush()
+}
+
+func (r *limitRuntime) flush() {
+	r.stopTimer()
+
 	if len(r.msg) > 0 {
-		r.ll.
-			WithField(caller.Skip, -1).
-			WithField(caller.GidKey, r.goroutineID).
-			WithField(caller.CallerKey, r.call).
-			Log(r.level, string(r.msg))
+		e := r.ll.WithFields(logrus.Fields{
+			caller.Skip:      -1,
+			caller.GidKey:    r.goroutineID,
+			caller.CallerKey: r.call,
+			limitedKey:       true,
+		})
+		if msg := string(withSuppressed(r.msg, r.suppressed)); r.name != "" {
+			LogLevel(e, r.name, msg)
+		} else {
+			e.Log(r.level, msg)
+		}
 		r.msg = nil
+		r.suppressed = 0
+		r.lastEmit = time.Now()
 	}
 }
 
+// idle tells whether the limit has no pending msg and no message since the idle timeout.
+func (r *limitRuntime) idle(now time.Time, timeout time.Duration) bool {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.msg == nil && r.suppressed == 0 && now.Sub(r.lastSeen) >= timeout
+}
+
+// close emits the pending msg and stops the timer.
+func (r *limitRuntime) close() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.flush()
+}
+
+// LimitOverflow defines what to do with the message of a new key when the limiter is full of keys.
+type LimitOverflow int
+
+const (
+	// LimitOverflowEvict evicts the least recently seen key, whose pending message is emitted.
+	LimitOverflowEvict LimitOverflow = iota
+	// LimitOverflowPass passes the message without limiting.
+	LimitOverflowPass
+	// LimitOverflowDrop drops the message.
+	LimitOverflowDrop
+)
+
+// LimiterOption defines the options of the limiter keys.
+type LimiterOption struct {
+	// MaxKeys is the max number of the limit keys, default 10000.
+	MaxKeys int
+	// IdleTimeout is the timeout to evict the idle keys, default 5m,
+	// and to emit the last dropped message of the limits only by count, like [L:3,0s].
+	IdleTimeout time.Duration
+	// Overflow is what to do with the new keys when the keys reach MaxKeys.
+	Overflow LimitOverflow
+}
+
+// LimiterStats is the stats of the limiter keys.
+type LimiterStats struct {
+	// Keys is the number of the current keys.
+	Keys int
+	// Evictions is the number of the keys evicted for idle or overflow.
+	Evictions uint64
+	// Overflows is the number of the new keys when the keys reach MaxKeys.
+	Overflows uint64
+}
+
 var (
 	limiter         = map[string]*limitRuntime{}
 	limiterLock     sync.Mutex
 	limiterRegistry = map[string]*LimitConf{}
+	limiterOption   = LimiterOption{MaxKeys: 10000, IdleTimeout: 5 * time.Minute}
+	limiterStats    LimiterStats
+	limiterSweep    time.Time
 )
 
+// SetLimiterOption sets the options of the limiter keys, the zero values are left as default.
+func SetLimiterOption(o LimiterOption) {
+	limiterLock.Lock()
+	defer limiterLock.Unlock()
+
+	if o.MaxKeys > 0 {
+		limiterOption.MaxKeys = o.MaxKeys
+	}
+	if o.IdleTimeout > 0 {
+		limiterOption.IdleTimeout = o.IdleTimeout
+	}
+	limiterOption.Overflow = o.Overflow
+}
+
+// GetLimiterStats returns the stats of the limiter keys.
+func GetLimiterStats() LimiterStats {
+	limiterLock.Lock()
+	defer limiterLock.Unlock()
+
+	stats := limiterStats
+	stats.Keys = len(limiter)
+	return stats
+}
+
 func Limit(ll *logrus.Logger, level logrus.Level, msg []byte, formatter *LogrusFormatter) (filteredMsg []byte, limited bool) {
+	return limit(ll, level, "", msg, formatter)
+}
+
+// limit limits the message by the conf parsed from it, the limited one is emitted later by ll at the custom level of name.
+func limit(ll FieldsWither, level logrus.Level, name string, msg []byte, formatter *LogrusFormatter) ([]byte, bool) {
 	conf, s := ParseLimitConf(msg)
-	if conf == nil {
-		return msg, false
+	if conf == nil { // the bad tag is removed anyway
+		return s, false
 	}
 
+	return limitBy(conf, ll, level, name, s, formatter)
+}
+
+// limitBy limits the message by the conf, the messages more severe than the level of the conf are never limited.
+func limitBy(conf *LimitConf, ll FieldsWither, level logrus.Level, name string, msg []byte, formatter *LogrusFormatter) ([]byte, bool) {
 	if level < conf.Level {
-		return s, false
+		return msg, false
+	}
+
+	rt, drop := getLimitRuntime(conf)
+	if rt == nil {
+		return msg, drop
 	}
 
+	s, allowed := rt.Allow(ll, level, name, msg, formatter)
+	return s, !allowed
+}
+
+// getLimitRuntime gets the runtime of the limit key, or creates it.
+// It returns nil when the keys reach the max and the overflow policy is not to evict, with drop for LimitOverflowDrop.
+func getLimitRuntime(conf *LimitConf) (rt *limitRuntime, drop bool) {
+	// the evicted one is closed after unlocking, which emits its pending msg by logging
+	var evicted *limitRuntime
+	defer func() {
+		if evicted != nil {
+			evicted.close()
+		}
+	}()
+
 	limiterLock.Lock()
 	defer limiterLock.Unlock()
 
-	rt := limiter[conf.Key]
-	if rt == nil {
-		rt = &limitRuntime{conf: conf}
-		limiter[conf.Key] = rt
+	now := time.Now()
+	if now.Sub(limiterSweep) >= limiterOption.IdleTimeout {
+		limiterSweep = now
+		evictIdle(now)
+	}
 
-		go rt.run()
+	if rt = limiter[conf.Key]; rt != nil {
+		return rt, false
 	}
 
-	rt.SendNewMsg(ll, level, s, formatter)
-	return nil, true
+	if len(limiter) >= limiterOption.MaxKeys {
+		limiterStats.Overflows++
+		if limiterOption.Overflow != LimitOverflowEvict {
+			return nil, limiterOption.Overflow == LimitOverflowDrop
+		}
+		evicted = evictOldest()
+	}
+
+	rt = &limitRuntime{conf: conf, idleTimeout: limiterOption.IdleTimeout}
+	limiter[conf.Key] = rt
+	return rt, false
+}
+
+func evictIdle(now time.Time) {
+	for k, rt := range limiter {
+		if rt.idle(now, limiterOption.IdleTimeout) {
+			delete(limiter, k)
+			limiterStats.Evictions++
+		}
+	}
+}
+
+// evictOldest evicts the least recently seen key, and returns its runtime to close.
+func evictOldest() *limitRuntime {
+	oldestKey := ""
+	var oldest time.Time
+	for k, rt := range limiter {
+		rt.Lock()
+		seen := rt.lastSeen
+		rt.Unlock()
+		if oldestKey == "" || seen.Before(oldest) {
+			oldestKey, oldest = k, seen
+		}
+	}
+
+	rt := limiter[oldestKey]
+	if rt != nil {
+		delete(limiter, oldestKey)
+		limiterStats.Evictions++
+	}
+	return rt
 }
 
 func getLimitConf(key string) *LimitConf {
@@ -160,14 +516,23 @@ func ParseLimitConf(msg []byte) (*LimitConf, []byte) {
 	confStr := string(confValue)
 
 	newMsg := clearMsg(msg, x, y)
-	conf := getLimitConf(confStr)
-	if conf != nil {
-		return conf, newMsg
+	return parseLimitConf(confStr, newMsg), newMsg
+}
+
+// parseLimitConf parses the limit conf like the xyz in [L:xyz], the name of the registered one,
+// or the inline one whose key is the first two words in the message if absent.
+func parseLimitConf(confStr string, msg []byte) *LimitConf {
+	if conf := getLimitConf(confStr); conf != nil {
+		return conf
+	}
+
+	if strings.Contains(confStr, "=") {
+		return parseStrategyConf(confStr, msg)
 	}
 
 	subs := reglimitSep.FindStringSubmatch(confStr)
 	if len(subs) == 0 {
-		return nil, newMsg
+		return nil
 	}
 
 	everyNumVal, everyTimeVal, keyVal := subs[1], subs[2], subs[3]
@@ -179,23 +544,13 @@ func ParseLimitConf(msg []byte) (*LimitConf, []byte) {
 
 	everyTime, err := time.ParseDuration(everyTimeVal)
 	if err != nil {
-		return nil, newMsg
+		return nil
 	}
 
 	if keyVal != "" {
 		keyVal = keyVal[1:]
 	} else {
-		spaceCount := 0
-		if idx := bytes.IndexFunc(newMsg, func(r rune) bool {
-			if unicode.IsSpace(r) {
-				spaceCount++
-			}
-			return spaceCount >= 2
-		}); idx < 0 {
-			keyVal = string(newMsg)
-		} else {
-			keyVal = string(newMsg[:idx])
-		}
+		keyVal = defaultLimitKey(msg)
 	}
 
 	return &LimitConf{
@@ -203,5 +558,80 @@ func ParseLimitConf(msg []byte) (*LimitConf, []byte) {
 		EveryTime: everyTime,
 		Key:       keyVal,
 		Level:     logrus.InfoLevel,
-	}, newMsg
+	}
+}
+
+// defaultLimitKey returns the first two words in the message as the limit key.
+func defaultLimitKey(msg []byte) string {
+	spaceCount := 0
+	if idx := bytes.IndexFunc(msg, func(r rune) bool {
+		if unicode.IsSpace(r) {
+			spaceCount++
+		}
+		return spaceCount >= 2
+	}); idx >= 0 {
+		return string(msg[:idx])
+	}
+
+	return string(msg)
+}
+
+// parseStrategyConf parses the limit conf of the strategies like tb=10/s,burst=20:key,
+// first=5/s,thereafter=100:key or p=0.1:key, the key is the first two words in the message if absent.
+// The bad options are ignored, and nil (no limiting) is returned when no strategy is parsed, like burst=5 only.
+func parseStrategyConf(confStr string, msg []byte) *LimitConf {
+	options, key, _ := strings.Cut(confStr, ":")
+	conf := &LimitConf{Key: strings.TrimSpace(key), Level: logrus.InfoLevel}
+	if conf.Key == "" {
+		conf.Key = defaultLimitKey(msg)
+	}
+
+	for k, v := range parseOptionMap(options) {
+		switch k {
+		case "tb", "rate":
+			if n, per, ok := parseRate(v); ok {
+				conf.Rate = n / per.Seconds()
+			}
+		case "burst":
+			conf.Burst = str.ParseInt(v, 0)
+		case "first":
+			if n, per, ok := parseRate(v); ok {
+				conf.First, conf.Tick = int(n), per
+			}
+		case "thereafter", "every":
+			conf.Thereafter = str.ParseInt(v, 0)
+		case "p", "prob":
+			if p, err := strconv.ParseFloat(v, 64); err == nil && p > 0 {
+				conf.Probability = math.Min(p, 1)
+			}
+		}
+	}
+
+	if conf.Rate <= 0 && conf.First <= 0 && conf.Thereafter <= 0 && conf.Probability <= 0 {
+		rotate.InnerPrint("E! bad limit tag [L:%s], no strategy parsed", confStr)
+		return nil
+	}
+
+	return conf
+}
+
+// parseRate parses the rate like 10/s, 100/m, 5/100ms or 10 (per second).
+func parseRate(s string) (n float64, per time.Duration, ok bool) {
+	num, unit, hasUnit := strings.Cut(s, "/")
+	n, err := strconv.ParseFloat(num, 64)
+	if err != nil || n <= 0 {
+		return 0, 0, false
+	}
+
+	per = time.Second
+	if hasUnit {
+		if unit != "" && (unit[0] < '0' || unit[0] > '9') {
+			unit = "1" + unit
+		}
+		if per, err = time.ParseDuration(unit); err != nil || per <= 0 {
+			return 0, 0, false
+		}
+	}
+
+	return n, per, true
 }
@@ -1,9 +1,18 @@
 package logfmt
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bingoohuang/golog/pkg/rotate"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -39,3 +48,360 @@ func TestParseLimitConf(t *testing.T) {
 	assert.Equal(t, LimitConf{EveryNum: 0, EveryTime: 15 * time.Second, Key: "LimitConf1", Level: logrus.InfoLevel}, *conf)
 	assert.Equal(t, `to limit using configuration whose name is LimitConf1`, string(msg))
 }
+
+func TestParseLimitStrategies(t *testing.T) {
+	conf, msg := ParseLimitConf([]byte(`[L:tb=10/s,burst=20:db.slow] slow query`))
+	assert.Equal(t, LimitConf{Rate: 10, Burst: 20, Key: "db.slow", Level: logrus.InfoLevel}, *conf)
+	assert.Equal(t, `slow query`, string(msg))
+
+	conf, _ = ParseLimitConf([]byte(`[L:tb=6/m] slow query took 10s`))
+	assert.Equal(t, LimitConf{Rate: 0.1, Key: "slow query", Level: logrus.InfoLevel}, *conf)
+
+	conf, _ = ParseLimitConf([]byte(`[L:first=5/100ms,thereafter=100:sample] hello`))
+	assert.Equal(t, LimitConf{First: 5, Tick: 100 * time.Millisecond, Thereafter: 100, Key: "sample", Level: logrus.InfoLevel}, *conf)
+
+	conf, _ = ParseLimitConf([]byte(`[L:p=0.1:prob] hello`))
+	assert.Equal(t, LimitConf{Probability: 0.1, Key: "prob", Level: logrus.InfoLevel}, *conf)
+
+	// no limiting without any strategy parsed, instead of dropping all the messages
+	for _, tag := range []string{"[L:burst=5:k]", "[L:p=abc:k]", "[L:tb=x:k]", "[L:p=0:k]", "[L:first=0/s:k]"} {
+		conf, msg = ParseLimitConf([]byte(tag + " hello"))
+		assert.Nil(t, conf, tag)
+		assert.Equal(t, "hello", string(msg), tag)
+
+		s, limited := Limit(logrus.New(), logrus.InfoLevel, []byte(tag+" hello"), nil)
+		assert.False(t, limited, tag)
+		assert.Equal(t, "hello", string(s), tag)
+	}
+}
+
+func TestLimitStrategies(t *testing.T) {
+	now := time.Now()
+	allowed := func(conf LimitConf, n int, interval time.Duration) (num int) {
+		r := &limitRuntime{conf: &conf}
+		for i := 0; i < n; i++ {
+			if r.allow(now.Add(time.Duration(i) * interval)) {
+				num++
+			}
+		}
+		return num
+	}
+
+	// the burst of 20, and 2.9 tokens refilled in the 30 messages of every 10ms
+	assert.Equal(t, 20, allowed(LimitConf{Rate: 10, Burst: 20}, 100, 0))
+	assert.Equal(t, 22, allowed(LimitConf{Rate: 10, Burst: 20}, 30, 10*time.Millisecond))
+	// the first 5, and then every 10th of the 100 messages in the same second
+	assert.Equal(t, 5+9, allowed(LimitConf{First: 5, Thereafter: 10}, 100, 0))
+	// the first 2 in each window of 1s, with 10 messages every 200ms
+	assert.Equal(t, 4, allowed(LimitConf{First: 2}, 10, 200*time.Millisecond))
+	assert.Equal(t, 0, allowed(LimitConf{Probability: 0}, 100, 0))
+	assert.Equal(t, 100, allowed(LimitConf{Probability: 1}, 100, 0))
+}
+
+func TestParseStdFields(t *testing.T) {
+	fs, msg := parseStdFields([]byte("[F:orderId=123,user=bob] order created"), false)
+	assert.Equal(t, Fields{"orderId": "123", "user": "bob"}, fs)
+	assert.Equal(t, "order created", string(msg))
+
+	fs, msg = parseStdFields([]byte("order [F:name='bingoo huang'] created amount=100"), false)
+	assert.Equal(t, Fields{"name": "bingoo huang"}, fs)
+	assert.Equal(t, "order created amount=100", string(msg))
+
+	fs, msg = parseStdFields([]byte("order [F:user=bob] created a=b=c orderId=123  amount=100 orderId=456"), true)
+	assert.Equal(t, Fields{"user": "bob", "orderId": "456", "amount": "100"}, fs)
+	assert.Equal(t, "order created a=b=c", string(msg))
+
+	fs, msg = parseStdFields([]byte("1+1=2"), true)
+	assert.Nil(t, fs)
+	assert.Equal(t, "1+1=2", string(msg))
+}
+
+func TestLimitSuppressed(t *testing.T) {
+	var buf bytes.Buffer
+	layout, _ := NewLayout(Option{Layout: "%msg%n"})
+	formatter := &LogrusFormatter{Formatter: Formatter{Layout: layout}}
+	ll := logrus.New()
+	ll.SetOutput(&buf)
+	ll.SetFormatter(formatter)
+
+	log := func(msg string) {
+		if s, limited := Limit(ll, logrus.InfoLevel, []byte(msg), formatter); !limited {
+			ll.Info(string(s))
+		}
+	}
+
+	for i := 1; i <= 7; i++ {
+		log(fmt.Sprintf("[L:3,0s:suppressed1] m%d", i))
+	}
+	assert.Equal(t, "m1\nm4 (+2 similar)\nm7 (+2 similar)\n", buf.String())
+
+	buf.Reset()
+	log("[L:first=1/50ms:suppressed2] a")
+	log("[L:first=1/50ms:suppressed2] b")
+	log("[L:first=1/50ms:suppressed2] c")
+	time.Sleep(100 * time.Millisecond)
+	log("[L:first=1/50ms:suppressed2] d")
+	assert.Equal(t, "a\nc (+1 similar)\nd\n", buf.String())
+	assert.True(t, GetMetrics().Suppressed >= 5)
+}
+
+func TestLimitSummary(t *testing.T) {
+	defer SetLimiterOption(LimiterOption{MaxKeys: 10000, IdleTimeout: 5 * time.Minute})
+	SetLimiterOption(LimiterOption{IdleTimeout: 50 * time.Millisecond})
+
+	var buf lockedBuffer
+	layout, _ := NewLayout(Option{Layout: "%msg%n"})
+	formatter := &LogrusFormatter{Formatter: Formatter{Layout: layout}}
+	ll := logrus.New()
+	ll.SetOutput(&buf)
+	ll.SetFormatter(formatter)
+
+	logs := func(tag string, n int) {
+		for i := 1; i <= n; i++ {
+			if s, limited := Limit(ll, logrus.InfoLevel, []byte(fmt.Sprintf("%s m%d", tag, i)), formatter); !limited {
+				ll.Info(string(s))
+			}
+		}
+	}
+
+	// the summary is emitted once at the next token, and not repeated
+	logs("[L:tb=10/s:summary.tb]", 5)
+	time.Sleep(350 * time.Millisecond)
+	assert.Equal(t, "m1\nm5 (+3 similar)\n", buf.String())
+
+	// the summary is emitted in the next window, taking its budget
+	buf.Reset()
+	logs("[L:first=1/100ms:summary.first]", 3)
+	time.Sleep(350 * time.Millisecond)
+	assert.Equal(t, "m1\nm3 (+1 similar)\n", buf.String())
+
+	// the summary of the limit only by count is emitted after the key is idle
+	buf.Reset()
+	logs("[L:3,0s:summary.count]", 6)
+	time.Sleep(150 * time.Millisecond)
+	assert.Equal(t, "m1\nm4 (+2 similar)\nm6 (+1 similar)\n", buf.String())
+
+	// the summary of the sampling is emitted only when sampled
+	now := time.Now()
+	r := &limitRuntime{conf: &LimitConf{Probability: 1e-9}}
+	assert.False(t, r.due(now))
+	assert.Equal(t, time.Second, r.emitDelay(now))
+	r = &limitRuntime{conf: &LimitConf{Probability: 1}}
+	assert.True(t, r.due(now))
+}
+
+// countWriter counts the lines written.
+type countWriter struct{ n atomic.Int64 }
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n.Add(int64(bytes.Count(p, []byte("\n"))))
+	return len(p), nil
+}
+
+func TestStdLimitDeferred(t *testing.T) {
+	var buf lockedBuffer
+	layout, _ := NewLayout(Option{Layout: "%l %fields %msg%n"})
+	formatter := &LogrusFormatter{Formatter: Formatter{Layout: layout}}
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.SetFormatter(DiscardFormatter{})
+	ll.AddHook(NewHook([]*rotate.WriterFormatter{{LevelWriter: rotate.WrapLevelWriter(&buf), Formatter: formatter}}))
+
+	std := log.New(&writerWrapper{ll: ll, formatter: formatter}, "", 0)
+	for i := 0; i < 3; i++ {
+		std.Printf("N! [L:5,50ms:std.deferred] [F:orderId=%d] order event", i)
+	}
+	time.Sleep(150 * time.Millisecond)
+	// the deferred one keeps its fields and custom level, and the annotation is before the new line
+	assert.Equal(t, "NOTICE {\"orderId\":\"0\"} order event\n"+
+		"NOTICE {\"orderId\":\"2\"} order event (+1 similar)\n", buf.String())
+}
+
+func TestLimiterKeys(t *testing.T) {
+	var out countWriter
+	ll := logrus.New()
+	ll.SetOutput(&out)
+	ll.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true})
+	ResetLimiter(t)
+	defer SetLimiterOption(LimiterOption{MaxKeys: 10000, IdleTimeout: 5 * time.Minute})
+
+	SetLimiterOption(LimiterOption{MaxKeys: 100, IdleTimeout: time.Hour})
+	goroutines := runtime.NumGoroutine()
+	stats := GetLimiterStats()
+	for i := 0; i < 10000; i++ {
+		// the second one of the key is dropped, and pending to emit at the eviction of the key
+		for j := 0; j < 2; j++ {
+			_, limited := Limit(ll, logrus.InfoLevel, []byte(fmt.Sprintf("[L:2,1h] key%d hello", i)), nil)
+			assert.Equal(t, j == 1, limited)
+		}
+	}
+	assert.True(t, runtime.NumGoroutine() <= goroutines+1)
+	s := GetLimiterStats()
+	assert.Equal(t, 100, s.Keys)
+	assert.True(t, s.Evictions-stats.Evictions >= 9900)
+	assert.True(t, s.Overflows-stats.Overflows >= 9900)
+	assert.True(t, out.n.Load() >= 9900)
+
+	SetLimiterOption(LimiterOption{Overflow: LimitOverflowDrop})
+	_, limited := Limit(ll, logrus.InfoLevel, []byte("[L:1,1h] new key"), nil)
+	assert.True(t, limited)
+	SetLimiterOption(LimiterOption{Overflow: LimitOverflowPass})
+	_, limited = Limit(ll, logrus.InfoLevel, []byte("[L:1,1h] new key"), nil)
+	assert.False(t, limited)
+
+	SetLimiterOption(LimiterOption{MaxKeys: 10000, IdleTimeout: 10 * time.Millisecond})
+	time.Sleep(20 * time.Millisecond)
+	Limit(ll, logrus.InfoLevel, []byte("[L:1,1h] last key"), nil)
+	// the 100 keys with the pending messages are not idle
+	assert.Equal(t, 100+1, GetLimiterStats().Keys)
+}
+
+type lockedBuffer struct {
+	sync.Mutex
+	bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.Buffer.String()
+}
+
+func TestDedup(t *testing.T) {
+	var buf lockedBuffer
+	layout, _ := NewLayout(Option{Layout: "%level %msg%n"})
+	formatter := &LogrusFormatter{Formatter: Formatter{Layout: layout}}
+	hook := NewHook([]*rotate.WriterFormatter{{LevelWriter: rotate.WrapLevelWriter(&buf), Formatter: formatter}})
+	hook.Dedup = &Dedup{Window: 50 * time.Millisecond, MaskNumbers: true}
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.SetFormatter(DiscardFormatter{})
+	ll.AddHook(hook)
+
+	for i := 1; i <= 4; i++ {
+		ll.Infof("dedup retry %d", i)
+	}
+	ll.Warnf("dedup retry %d", 5)
+	assert.Equal(t, " INFO dedup retry 1\n WARN dedup retry 5\n", buf.String())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, " INFO dedup retry 1\n WARN dedup retry 5\n INFO dedup retry 4 (+2 similar)\n", buf.String())
+
+	time.Sleep(100 * time.Millisecond)
+	ll.Info("dedup retry 6")
+	assert.Equal(t, " INFO dedup retry 1\n WARN dedup retry 5\n INFO dedup retry 4 (+2 similar)\n INFO dedup retry 6\n", buf.String())
+	// the keys of the ended windows are expired, not taking the limiter keys
+	assert.Equal(t, 1, hook.Dedup.Keys())
+
+	keys := GetLimiterStats().Keys
+	hook.Dedup.MaxKeys = 3
+	buf.Reset()
+	for i := 0; i < 5; i++ {
+		ll.Infof("dedup distinct %c", 'a'+i)
+		ll.Infof("dedup distinct %c", 'a'+i)
+	}
+	assert.Equal(t, 3, hook.Dedup.Keys())
+	assert.Equal(t, keys, GetLimiterStats().Keys)
+	// the 2 new keys besides the retry one are collapsed, and the messages of the ones beyond the max are not
+	assert.Equal(t, 2+3*2, strings.Count(buf.String(), "dedup distinct"))
+}
+
+func TestWithLimit(t *testing.T) {
+	var buf lockedBuffer
+	layout, _ := NewLayout(Option{Layout: "%level %msg %fields%n"})
+	formatter := &LogrusFormatter{Formatter: Formatter{Layout: layout}}
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.SetFormatter(DiscardFormatter{})
+	ll.AddHook(NewHook([]*rotate.WriterFormatter{{LevelWriter: rotate.WrapLevelWriter(&buf), Formatter: formatter}}))
+
+	RegisterLimitConf(LimitConf{Key: "withLimit1", EveryNum: 3, Level: logrus.WarnLevel})
+	for i := 1; i <= 4; i++ {
+		WithLimit(ll, "withLimit1").WithField("i", i).Warnf("slow query")
+	}
+	WithLimit(ll, "withLimit1").Error("not limited")
+	assert.Equal(t, " WARN slow query {\"i\":1}\n WARN slow query (+2 similar) {\"i\":4}\nERROR not limited \n", buf.String())
+
+	buf.Reset()
+	for i := 1; i <= 3; i++ {
+		WithLimit(ll, "50ms:withLimit2").Infof("retry %d", i)
+	}
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, " INFO retry 1 \n INFO retry 3 (+1 similar) \n", buf.String())
+}
+
+func TestStdAsync(t *testing.T) {
+	var buf lockedBuffer
+	layout, _ := NewLayout(Option{Layout: "%level %msg%n"})
+	formatter := &LogrusFormatter{Formatter: Formatter{Layout: layout}}
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.SetFormatter(DiscardFormatter{})
+	ll.AddHook(NewHook([]*rotate.WriterFormatter{{LevelWriter: rotate.WrapLevelWriter(&buf), Formatter: formatter}}))
+
+	w := &writerWrapper{ll: ll, formatter: formatter}
+	_, _ = w.Write([]byte("[LOG_ASYNC] W! async hello"))
+	_, _ = w.Write([]byte("[LOG_OFF] off"))
+	_, _ = w.Write([]byte("[LOG_ASYNC] W! async world"))
+	_, _ = w.Write([]byte("[LOG_ASYNC] async bye"))
+	w.async.Load().Flush()
+	// each message is logged as an entry, not joined with the ones of the same level in a batch
+	assert.Equal(t, " WARN async hello\n WARN async world\n INFO async bye\n", buf.String())
+	assert.Equal(t, uint64(3), w.async.Load().Stats().Written)
+
+	// the notice of the dropped ones is logged by the sink of the async writer
+	buf.Reset()
+	_, _ = w.writeInternal(asyncOptionFromEnv().OnDrop(5))
+	assert.Equal(t, " WARN async log queue overflow, 5 dropped\n", buf.String())
+	notice := dropNotice(formatter)(5)
+	assert.Equal(t, " WARN async log queue overflow, 5 dropped\n", string(notice))
+}
+
+// slowWriter writes after a while, like a slow disk.
+type slowWriter struct{ lockedBuffer }
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(20 * time.Millisecond)
+	return w.lockedBuffer.Write(p)
+}
+
+func TestStdFatalFlush(t *testing.T) {
+	var out slowWriter
+	layout, _ := NewLayout(Option{Layout: "%level %msg%n"})
+	formatter := &LogrusFormatter{Formatter: Formatter{Layout: layout}}
+	async := rotate.NewAsyncWriter(rotate.WrapLevelWriter(&out), rotate.AsyncOption{})
+	defer async.Close()
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.SetFormatter(DiscardFormatter{})
+	ll.AddHook(NewHook([]*rotate.WriterFormatter{{LevelWriter: async, Formatter: formatter}}))
+
+	std := log.New(&writerWrapper{ll: ll, formatter: formatter}, "", 0)
+	std.Print("[LOG_ASYNC] queued")
+	func() {
+		defer func() { assert.NotNil(t, recover()) }()
+		std.Panic("boom") // untagged, logged at info
+	}()
+	assert.Equal(t, " INFO queued\n INFO boom\n", out.String())
+
+	// no async writer is started just to be flushed
+	var buf lockedBuffer
+	ll = logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.SetFormatter(DiscardFormatter{})
+	ll.AddHook(NewHook([]*rotate.WriterFormatter{{LevelWriter: rotate.WrapLevelWriter(&buf), Formatter: formatter}}))
+	w := &writerWrapper{ll: ll, formatter: formatter}
+	assert.False(t, w.hasAsync())
+	func() {
+		defer func() { assert.NotNil(t, recover()) }()
+		log.New(w, "", 0).Panic("boom")
+	}()
+	assert.Nil(t, w.async.Load())
+	assert.Equal(t, " INFO boom\n", buf.String())
+}
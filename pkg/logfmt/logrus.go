@@ -5,9 +5,12 @@ import (
 	"io"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
+	"github.com/bingoohuang/golog/pkg/caller"
 	"github.com/bingoohuang/golog/pkg/local"
+	"github.com/bingoohuang/golog/pkg/redact"
 	"github.com/bingoohuang/golog/pkg/rotate"
 	"github.com/sirupsen/logrus"
 )
@@ -18,12 +21,19 @@ type LogrusEntry struct {
 }
 
 func (e LogrusEntry) Time() time.Time        { return e.Entry.Time }
-func (e LogrusEntry) Level() string          { return e.Entry.Level.String() }
 func (e LogrusEntry) TraceID() string        { return e.EntryTraceID }
 func (e LogrusEntry) Fields() Fields         { return Fields(e.Entry.Data) }
 func (e LogrusEntry) Message() string        { return e.Entry.Message }
 func (e LogrusEntry) Caller() *runtime.Frame { return e.Entry.Caller }
 
+// Level returns the level name, the custom one like notice if any.
+func (e LogrusEntry) Level() string {
+	if name, ok := e.Entry.Data[LevelKey].(string); ok {
+		return strings.ToLower(name)
+	}
+	return e.Entry.Level.String()
+}
+
 // Option defines the options to setup logrus logging system.
 type Option struct {
 	Layout string
@@ -31,16 +41,33 @@ type Option struct {
 	Level  string
 	Rotate string
 
-	LogPath      string
-	TotalSizeCap int64 // 可选，用来指定所有日志文件的总大小上限，例如设置为3GB的话，那么到了这个值，就会删除旧的日志
-	MaxSize      int64
-	MaxAge       time.Duration
-	GzipAge      time.Duration
-	Simple       bool
-	Stdout       bool
-	PrintCaller  bool
-	PrintColor   bool
-	FixStd       bool // 是否增强log.Print...的输出
+	LogPath         string
+	TotalSizeCap    int64 // 可选，用来指定所有日志文件的总大小上限，例如设置为3GB的话，那么到了这个值，就会删除旧的日志
+	MaxSize         int64
+	MaxAge          time.Duration
+	GzipAge         time.Duration
+	Simple          bool
+	Stdout          bool
+	PrintCaller     bool
+	PrintColor      bool
+	PrintStack      string        // 打印堆栈的最低级别，例如 error，为空时不打印
+	Redact          string        // 脱敏规则，例如 mobile|idCard:hash|password:drop，all 表示全部规则
+	RedactKey       string        // 脱敏 hash 方式的 HMAC 密钥，同一部署应使用相同的密钥以便关联，为空时使用进程内随机密钥
+	Sanitize        bool          // 是否转义日志文件中消息和字段的控制字符，防止日志注入
+	MaxEntrySize    int64         // 单条日志消息和文本字段的总大小上限，超过时截断，0 表示不限制
+	Multiline       string        // 多行消息的打印方式：escape（默认，转义换行），raw（原样），indent（续行缩进）
+	MultilinePrefix string        // indent 方式的续行前缀，默认两个空格
+	FixStd          bool          // 是否增强log.Print...的输出
+	StdFields       string        // log.Print...的字段解析方式：tag（默认，仅解析 [F:k=v]），trailing（还解析消息末尾的 k=v）
+	Dedup           time.Duration // 合并重复日志的时间窗口，窗口内同级别同调用位置的相同消息只打印首条和末条（附带重复次数），0 表示不合并
+	DedupMask       bool          // 合并重复日志时是否忽略消息中的数字差异
+	Async           bool          // 是否异步写日志，日志在调用方格式化，由后台协程写入
+	AsyncOverflow   string        // 异步队列满时的处理：block，dropNewest，dropOldest，dropBelow:error（默认，ERROR 及以上等待不丢弃）
+	AsyncQueueSize  int           // 异步队列的大小，默认 10000
+	CaptureStderr   bool          // 是否捕获进程的标准错误输出（如 panic 和第三方库的输出），作为 ERROR 日志写入，同时仍输出到原标准错误
+	DumpSignal      string        // 触发协程堆栈转储的信号，例如 SIGQUIT，转储按相同堆栈分组写入日志文件旁的 .goroutines.时间 文件，为空时不启用
+
+	fieldEncoder FieldEncoder
 }
 
 type DiscardFormatter struct{}
@@ -101,14 +128,26 @@ func (lo Option) Setup(ll *logrus.Logger) *Result {
 		if err != nil {
 			panic(err)
 		}
+		if lo.CaptureStderr { // the crash output is reset to the new log file after rotated
+			rotate.WithHandler(setCrashOutputOnRotate(r.LogFile())).Apply(r)
+		}
 
 		g.Rotate = r
+		fileFormatter := resetPrintColor(formatter)
+		fileFormatter.Sanitize = lo.Sanitize
+		fileFormatter.SkipMetrics = lo.Stdout // counted by the stdout formatter already
 		writers = append(writers, &rotate.WriterFormatter{
 			LevelWriter: r,
-			Formatter:   resetPrintColor(formatter),
+			Formatter:   fileFormatter,
 		})
 	}
 
+	ll = lo.setLoggerLevel(ll)
+	g.logger = ll
+	if lo.Async {
+		g.Async = lo.wrapAsync(writers)
+	}
+
 	var ws []io.Writer
 	for _, w := range writers {
 		ws = append(ws, rotate.WrapWriter(w))
@@ -116,15 +155,38 @@ func (lo Option) Setup(ll *logrus.Logger) *Result {
 
 	g.Writer = io.MultiWriter(ws...)
 
-	ll = lo.setLoggerLevel(ll)
 	ll.SetFormatter(&DiscardFormatter{})
 	ll.SetOutput(io.Discard)
 
 	ll.Hooks = make(logrus.LevelHooks)
-	ll.AddHook(NewHook(writers))
+	hook := NewHook(writers)
+	if lo.Dedup > 0 {
+		hook.Dedup = &Dedup{Window: lo.Dedup, MaskNumbers: lo.DedupMask}
+	}
+	ll.AddHook(hook)
 
 	if lo.FixStd {
-		fixStd(ll, formatter)
+		fixStd(ll, formatter, strings.EqualFold(lo.StdFields, "trailing"))
+	}
+
+	if lo.CaptureStderr {
+		logFile := ""
+		if g.Rotate != nil {
+			logFile = g.Rotate.LogFile()
+		}
+		if err := captureStderr(ll, logFile); err != nil {
+			fmt.Printf("failed to capture stderr, error: %v", err)
+		}
+	}
+
+	if lo.DumpSignal != "" {
+		sig, err := ParseSignal(lo.DumpSignal)
+		if err == nil {
+			err = g.RegisterSignalDump(sig)
+		}
+		if err != nil {
+			fmt.Printf("failed to register dumpSignal, error: %v", err)
+		}
 	}
 
 	ll.Debugf("log file created: %s", lo.LogPath)
@@ -132,6 +194,48 @@ func (lo Option) Setup(ll *logrus.Logger) *Result {
 	return g
 }
 
+// wrapAsync wraps the writers to write in the background goroutines, the entries are still formatted by the callers.
+func (lo Option) wrapAsync(writers []*rotate.WriterFormatter) []*rotate.AsyncWriter {
+	option := rotate.AsyncOption{
+		QueueSize: lo.AsyncQueueSize,
+		Overflow:  rotate.AsyncDropBelowLevel,
+		KeepLevel: logrus.ErrorLevel,
+	}
+	if lo.AsyncOverflow != "" {
+		overflow, keepLevel, err := rotate.ParseAsyncOverflow(lo.AsyncOverflow)
+		if err != nil {
+			fmt.Printf("failed to parse asyncOverflow, error: %v", err)
+		} else {
+			option.Overflow, option.KeepLevel = overflow, keepLevel
+		}
+	}
+
+	asyncWriters := make([]*rotate.AsyncWriter, 0, len(writers))
+	for _, w := range writers {
+		option.OnDrop = dropNotice(w.Formatter)
+		a := rotate.NewAsyncWriter(w.LevelWriter, option)
+		w.LevelWriter = a
+		asyncWriters = append(asyncWriters, a)
+	}
+
+	return asyncWriters
+}
+
+// dropNotice returns the OnDrop of the AsyncWriter, which formats the notice of the dropped entries by the formatter
+// to write to its own sink, instead of logging it back through the logger with the other AsyncWriters.
+func dropNotice(formatter logrus.Formatter) func(dropped uint64) []byte {
+	return func(dropped uint64) []byte {
+		e := &logrus.Entry{
+			Data:    logrus.Fields{caller.Skip: -1, SeqKey: nextSeq()},
+			Time:    time.Now(),
+			Level:   logrus.WarnLevel,
+			Message: fmt.Sprintf("async log queue overflow, %d dropped", dropped),
+		}
+		notice, _ := formatter.Format(e)
+		return notice
+	}
+}
+
 func resetPrintColor(formatter *LogrusFormatter) *LogrusFormatter {
 	f1 := *formatter
 	f1.PrintColor = false
@@ -154,11 +258,37 @@ func (lo Option) createFormatter() *LogrusFormatter {
 		}
 	}
 
+	var stackPart *StackPart
+	if lo.PrintStack != "" {
+		p, err := parseStackPart("level=" + lo.PrintStack)
+		if err != nil {
+			fmt.Printf("failed to parse printStack, error: %v", err)
+		} else {
+			stackPart = &p
+		}
+	}
+
+	multiline, err := ParseMultiline(lo.Multiline, lo.MultilinePrefix)
+	if err != nil {
+		fmt.Printf("failed to parse multiline, error: %v", err)
+	}
+
+	redactor, err := redact.New(lo.Redact)
+	if err != nil {
+		fmt.Printf("failed to parse redact, error: %v", err)
+	}
+	redactor.SetHashKey([]byte(lo.RedactKey))
+	redact.SetDefault(redactor)
+
 	return &LogrusFormatter{Formatter: Formatter{
-		PrintColor:  lo.PrintColor,
-		PrintCaller: lo.PrintCaller,
-		Simple:      lo.Simple,
-		Layout:      layout,
+		PrintColor:   lo.PrintColor,
+		PrintCaller:  lo.PrintCaller,
+		Simple:       lo.Simple,
+		Layout:       layout,
+		Stack:        stackPart,
+		Redactor:     redactor,
+		MaxEntrySize: int(lo.MaxEntrySize),
+		Multiline:    multiline,
 	}}
 }
 
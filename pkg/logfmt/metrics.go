@@ -0,0 +1,28 @@
+package logfmt
+
+import "sync/atomic"
+
+// Metrics is the snapshot of the logging metrics.
+type Metrics struct {
+	// Truncations is the number of the truncated messages, fields and payloads.
+	Truncations uint64
+	// TruncatedBytes is the number of bytes truncated.
+	TruncatedBytes uint64
+	// Suppressed is the number of the messages dropped by the limiters.
+	Suppressed uint64
+}
+
+var metrics struct {
+	truncations    atomic.Uint64
+	truncatedBytes atomic.Uint64
+	suppressed     atomic.Uint64
+}
+
+// GetMetrics returns the snapshot of the logging metrics.
+func GetMetrics() Metrics {
+	return Metrics{
+		Truncations:    metrics.truncations.Load(),
+		TruncatedBytes: metrics.truncatedBytes.Load(),
+		Suppressed:     metrics.suppressed.Load(),
+	}
+}
@@ -5,14 +5,42 @@ import (
 	"io"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/bingoohuang/golog/pkg/rotate"
+	"github.com/sirupsen/logrus"
 )
 
 type Result struct {
 	io.Writer
 	Rotate *rotate.Rotate
 	Option Option
+	// Async is the async writers of the outputs when Option.Async is on.
+	Async []*rotate.AsyncWriter
+
+	logger *logrus.Logger
+}
+
+// AsyncStats returns the stats of the async writers in total, with the max of the queue depths and latencies.
+func (r *Result) AsyncStats() rotate.AsyncStats {
+	var stats rotate.AsyncStats
+	for _, a := range r.Async {
+		s := a.Stats()
+		stats.Queued += s.Queued
+		stats.Written += s.Written
+		stats.Dropped += s.Dropped
+		if s.MaxQueued > stats.MaxQueued {
+			stats.MaxQueued = s.MaxQueued
+		}
+		if s.Latency > stats.Latency {
+			stats.Latency = s.Latency
+		}
+		if s.MaxLatency > stats.MaxLatency {
+			stats.MaxLatency = s.MaxLatency
+		}
+	}
+
+	return stats
 }
 
 // RegisterSignalRotate register a signal like syscall.SIGHUP to rotate the log file.
@@ -33,6 +61,57 @@ func (r *Result) RegisterSignalRotate(sig ...os.Signal) error {
 	return nil
 }
 
+// RegisterSignalDump registers a signal like syscall.SIGQUIT to dump the goroutines into the file next to the log file,
+// instead of dumping to stderr and exiting.
+func (r *Result) RegisterSignalDump(sig ...os.Signal) error {
+	if r.Rotate == nil {
+		return fmt.Errorf("rotater is not initialized")
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+
+	go func() {
+		for range c {
+			file, err := r.DumpGoroutines()
+			if err != nil {
+				rotate.InnerPrint("E! dump goroutines to %s error %v", file, err)
+			} else if r.logger != nil {
+				r.logger.Warnf("goroutines dumped to %s", file)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// DumpGoroutines dumps the goroutines grouped by the identical stacks into the file next to the log file,
+// like app.log.goroutines.2026-10-17-10-30-05, appended in the same second, which is kept by the same retention rules
+// of the log files, and returns the file name.
+func (r *Result) DumpGoroutines() (string, error) {
+	if r.Rotate == nil {
+		return "", fmt.Errorf("rotater is not initialized")
+	}
+
+	file := r.Rotate.LogFile() + ".goroutines." + time.Now().Format("2006-01-02-15-04-05")
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return file, err
+	}
+	defer f.Close()
+
+	return file, DumpGoroutines(f)
+}
+
+// OnExit drains the async writers and closes the log file.
 func (r *Result) OnExit() error {
+	for _, a := range r.Async {
+		_ = a.Close()
+	}
+
+	if r.Rotate == nil {
+		return nil
+	}
+
 	return r.Rotate.Close()
 }
@@ -0,0 +1,74 @@
+package logfmt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// preMarker leading the message prints it raw, like log.Printf("[PRE]%s", sql).
+const preMarker = "[PRE]"
+
+// Multiline defines how to print the multi-line messages.
+type Multiline struct {
+	// Mode is one of escape (default, new lines escaped to \n), raw (as is),
+	// and indent (continuation lines indented with Prefix).
+	Mode string
+	// Prefix is the prefix of the continuation lines in the indent mode, default two spaces.
+	Prefix string
+}
+
+// ParseMultiline parses the multi-line mode of escape, raw or indent.
+func ParseMultiline(mode, prefix string) (Multiline, error) {
+	m := Multiline{Mode: strings.ToLower(mode), Prefix: prefix}
+	switch m.Mode {
+	case "", "escape", "raw", "indent":
+		return m, nil
+	default:
+		return m, fmt.Errorf("unknown multiline mode %s", mode)
+	}
+}
+
+// Write writes the message to b in the mode, the trailing new lines are trimmed,
+// and the message led by the [PRE] marker is written raw with the marker removed.
+func (m Multiline) Write(b *bytes.Buffer, msg string) {
+	m.write(b, msg, "raw")
+}
+
+// writeEntry writes the message of the entry like Write, while the one of the sanitized entry led by
+// the [PRE] marker is written indented instead of raw, since the marker may come from the user data
+// with the fake log lines following.
+func (m Multiline) writeEntry(b *bytes.Buffer, e Entry) {
+	preMode := "raw"
+	if isSanitized(e.Fields()) {
+		preMode = "indent"
+	}
+	m.write(b, e.Message(), preMode)
+}
+
+func (m Multiline) write(b *bytes.Buffer, msg, preMode string) {
+	mode, pre := m.Mode, strings.HasPrefix(msg, preMarker)
+	if pre {
+		msg, mode = msg[len(preMarker):], preMode
+	}
+	if !pre || mode != "raw" { // the raw [PRE] message is kept as is
+		msg = strings.TrimRight(msg, "\r\n")
+	}
+
+	switch mode {
+	case "raw":
+		b.WriteString(msg)
+	case "indent":
+		prefix := m.Prefix
+		if prefix == "" {
+			prefix = "  "
+		}
+
+		msg = strings.ReplaceAll(msg, "\r\n", "\n")
+		msg = strings.ReplaceAll(msg, "\r", `\r`)
+		b.WriteString(strings.ReplaceAll(msg, "\n", "\n"+prefix))
+	default:
+		msg = strings.ReplaceAll(msg, "\n", `\n`)
+		b.WriteString(strings.ReplaceAll(msg, "\r", `\r`))
+	}
+}
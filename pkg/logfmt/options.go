@@ -0,0 +1,121 @@
+package logfmt
+
+import (
+	"strings"
+	"unicode"
+)
+
+// splitOptions splits the options by commas or spaces,
+// the quoted parts like prefix='| ' are kept intact with the quotes removed.
+func splitOptions(options string) []string {
+	var fields []string
+	var b strings.Builder
+	var quote rune
+	inField := false
+	for _, c := range options {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				b.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inField = c, true
+		case unicode.IsSpace(c) || c == ',':
+			if inField {
+				fields = append(fields, b.String())
+				b.Reset()
+				inField = false
+			}
+		default:
+			b.WriteRune(c)
+			inField = true
+		}
+	}
+
+	if inField {
+		fields = append(fields, b.String())
+	}
+
+	return fields
+}
+
+// joinOptions joins the options split by splitOptions, quoting the ones with separators.
+func joinOptions(fields []string) string {
+	quoted := make([]string, len(fields))
+	for i, f := range fields {
+		switch {
+		case !strings.ContainsAny(f, " \t,'\""):
+			quoted[i] = f
+		case strings.Contains(f, "'"):
+			quoted[i] = `"` + f + `"`
+		default:
+			quoted[i] = "'" + f + "'"
+		}
+	}
+
+	return strings.Join(quoted, ",")
+}
+
+// cutOptionFlag removes the flag option like omitEmpty from the options, and tells whether it is found.
+func cutOptionFlag(options, flag string) (string, bool) {
+	fields := splitOptions(options)
+	found := false
+	kept := fields[:0]
+	for _, f := range fields {
+		if strings.EqualFold(f, flag) {
+			found = true
+		} else {
+			kept = append(kept, f)
+		}
+	}
+
+	if !found {
+		return options, false
+	}
+
+	return joinOptions(kept), true
+}
+
+// parseOptionMap parses the options like name=userId,default=- to a map with lower-cased keys,
+// options without = are mapped to empty values.
+func parseOptionMap(options string) map[string]string {
+	m := map[string]string{}
+	for _, f := range splitOptions(options) {
+		k, v, _ := strings.Cut(f, "=")
+		m[strings.ToLower(k)] = v
+	}
+
+	return m
+}
+
+// parseOptionLists parses the options like parseOptionMap, while the values of the list keys are collected as lists,
+// and the options without = following a list key continue the list, like include=userId,orderId,exclude=password.
+func parseOptionLists(options string, listKeys ...string) (map[string]string, map[string][]string) {
+	m := map[string]string{}
+	lists := map[string][]string{}
+	listKey := ""
+	for _, f := range splitOptions(options) {
+		k, v, hasValue := strings.Cut(f, "=")
+		if !hasValue && listKey != "" {
+			lists[listKey] = append(lists[listKey], f)
+			continue
+		}
+
+		k = strings.ToLower(k)
+		if listKey = ""; hasValue {
+			for _, lk := range listKeys {
+				if k == strings.ToLower(lk) {
+					listKey = k
+					lists[k] = append(lists[k], v)
+				}
+			}
+		}
+		if listKey == "" {
+			m[k] = v
+		}
+	}
+
+	return m, lists
+}
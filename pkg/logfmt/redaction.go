@@ -0,0 +1,113 @@
+package logfmt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/bingoohuang/golog/pkg/redact"
+)
+
+// redactedEntry is the entry with the sensitive data in the message and fields redacted.
+type redactedEntry struct {
+	Entry
+	message string
+	fields  Fields
+}
+
+func (e redactedEntry) Message() string { return e.message }
+func (e redactedEntry) Fields() Fields  { return e.fields }
+
+func redactEntry(e Entry, r *redact.Redactor) Entry {
+	return redactedEntry{Entry: e, message: r.String(e.Message()), fields: redactFields(e.Fields(), r)}
+}
+
+func redactFields(fs Fields, r *redact.Redactor) Fields {
+	m := make(Fields, len(fs))
+	for k, v := range fs {
+		if isInternalKey(k) {
+			m[k] = v
+			continue
+		}
+
+		s, ok := textValue(v)
+		if !ok && !r.IsSensitiveField(k) {
+			if rv, changed := redactComposite(v, r); changed {
+				v = rv
+			}
+			m[k] = v
+			continue
+		}
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+
+		rs, keep := r.Field(k, s)
+		if !keep {
+			continue
+		}
+		if rs != s {
+			v = rs
+		}
+		m[k] = v
+	}
+
+	return m
+}
+
+// redactComposite redacts the map, struct and slice value by its JSON, like the Password of a struct,
+// and returns the JSON-decoded value redacted and whether anything is redacted.
+func redactComposite(v interface{}, r *redact.Redactor) (interface{}, bool) {
+	if !isComposite(v) {
+		return v, false
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v, false
+	}
+
+	var decoded interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&decoded); err != nil {
+		return v, false
+	}
+
+	return r.JSON(decoded)
+}
+
+// isComposite tells whether the value is a map, struct, slice or array, or the pointer to them.
+func isComposite(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Map, reflect.Struct, reflect.Slice, reflect.Array:
+		return true
+	default:
+		return false
+	}
+}
+
+// textValue returns the text of the value to be redacted, like string, []byte, error and fmt.Stringer.
+func textValue(v interface{}) (string, bool) {
+	if isNilPointer(v) {
+		return "", false
+	}
+
+	switch t := v.(type) {
+	case string:
+		return t, true
+	case []byte:
+		return string(t), true
+	case error:
+		return errorText(t), true
+	case fmt.Stringer:
+		return t.String(), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,101 @@
+package logfmt
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// RawKey is the key to opt out the sanitizing of the entry, like logrus.WithField(logfmt.RawKey, true).
+const RawKey = "_GologRaw"
+
+// sanitizeKey marks the fields of the sanitized entry, whose values are escaped when rendered as text.
+const sanitizeKey = "_GologSanitize"
+
+// sanitizedEntry is the entry with the control characters in the message escaped.
+type sanitizedEntry struct {
+	Entry
+	message string
+	fields  Fields
+}
+
+func (e sanitizedEntry) Message() string { return e.message }
+func (e sanitizedEntry) Fields() Fields  { return e.fields }
+
+// sanitizeEntry escapes the control characters in the message to avoid the log injection,
+// like the ANSI escape sequences or the fake log lines. The new lines of the message are kept,
+// which are handled by the singleLine option of %msg, or indented for [PRE].
+// The fields are marked to be escaped by their text renderings, like %field and %fields{style=kv},
+// while the JSON ones are escaped by the JSON encoding already.
+func sanitizeEntry(e Entry) Entry {
+	fs := e.Fields()
+	if raw, _ := fs[RawKey].(bool); raw {
+		return e
+	}
+
+	m := make(Fields, len(fs)+1)
+	for k, v := range fs {
+		m[k] = v
+	}
+	m[sanitizeKey] = true
+
+	// the trailing new lines are trimmed by the formatter anyway.
+	msg := strings.TrimRight(e.Message(), "\r\n")
+	return sanitizedEntry{Entry: e, message: Sanitize(msg, true), fields: m}
+}
+
+// sanitizeText escapes the text rendering of the field key or value if the fields are sanitized.
+func sanitizeText(fs Fields, s string) string {
+	if isSanitized(fs) {
+		return Sanitize(s, false)
+	}
+
+	return s
+}
+
+// isSanitized tells whether the fields are of the sanitized entry.
+func isSanitized(fs Fields) bool {
+	sanitized, _ := fs[sanitizeKey].(bool)
+	return sanitized
+}
+
+// Sanitize escapes the C0/C1 control characters (except tab, and new line if keepNewLine),
+// the Unicode line separators and the invalid UTF-8 bytes in s, like \x1b, \r, \u0085 and \xff.
+func Sanitize(s string, keepNewLine bool) string {
+	i := 0
+	for ; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c >= 0x7f {
+			break
+		}
+	}
+	if i == len(s) {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	b.WriteString(s[:i])
+
+	for i < len(s) {
+		r, n := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && n == 1:
+			_, _ = fmt.Fprintf(&b, `\x%02x`, s[i])
+		case r == '\t', r == '\n' && keepNewLine:
+			b.WriteRune(r)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			_, _ = fmt.Fprintf(&b, `\x%02x`, r)
+		case r >= 0x80 && r <= 0x9f, r == 0x2028, r == 0x2029:
+			_, _ = fmt.Fprintf(&b, `\u%04x`, r)
+		default:
+			b.WriteString(s[i : i+n])
+		}
+		i += n
+	}
+
+	return b.String()
+}
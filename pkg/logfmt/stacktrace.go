@@ -0,0 +1,205 @@
+package logfmt
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"sort"
+
+	"github.com/bingoohuang/golog/pkg/caller"
+	"github.com/bingoohuang/golog/pkg/stack"
+	"github.com/bingoohuang/golog/pkg/str"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// StackKey is the key of the stack.CallStack captured by the Hook for the entries to print the stack,
+// see Formatter.StackLevel.
+const StackKey = "_GologStack"
+
+// StackPart prints the stack trace of the entry, like %stack{level=error,depth=20,trimRuntime=true}.
+// The stack recorded in the error field created by github.com/pkg/errors takes precedence,
+// or else the one captured by the Hook, or captured at the formatting time.
+type StackPart struct {
+	CallerFormat
+	// Level is the lowest level to print the stack, default error.
+	Level logrus.Level
+	// Depth is the max number of frames to print, default 20.
+	Depth int
+	// TrimRuntime trims the frames of the go runtime at the bottom, default true.
+	TrimRuntime bool
+}
+
+func (p StackPart) Append(b *bytes.Buffer, e Entry) {
+	for _, f := range p.Frames(e) {
+		b.WriteString("\n\t")
+		p.CallerFormat.Append(b, &f)
+	}
+}
+
+// Strings returns the formatted frames of the stack, like for the stack key in the JSON.
+func (p StackPart) Strings(e Entry) []string {
+	frames := p.Frames(e)
+	if len(frames) == 0 {
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	ss := make([]string, len(frames))
+	for i, f := range frames {
+		buf.Reset()
+		p.CallerFormat.Append(buf, &f)
+		ss[i] = buf.String()
+	}
+
+	return ss
+}
+
+// Frames returns the frames of the stack to print, or nil if the level of the entry is lower than Level.
+func (p StackPart) Frames(e Entry) []runtime.Frame {
+	if ll := parseLevelName(e.Level()); ll > p.Level {
+		return nil
+	}
+
+	fs := e.Fields()
+	cs := errorStack(fs)
+	if cs == nil {
+		if v, ok := fs[StackKey].(stack.CallStack); ok {
+			cs = v
+		} else {
+			cs = stack.Trace()
+		}
+		cs = trimInternal(cs)
+	}
+
+	if p.TrimRuntime {
+		cs = cs.TrimRuntime()
+	}
+	if p.Depth > 0 && len(cs) > p.Depth {
+		cs = cs[:p.Depth]
+	}
+
+	frames := make([]runtime.Frame, len(cs))
+	for i, c := range cs {
+		frames[i] = c.Frame()
+	}
+
+	return frames
+}
+
+// trimInternal trims the frames of the logging internals at the top.
+func trimInternal(cs stack.CallStack) stack.CallStack {
+	for len(cs) > 0 && caller.IsSkipPackage(caller.GetPackageName(cs[0].Frame().Function)) {
+		cs = cs[1:]
+	}
+	return cs
+}
+
+type stackTracer interface {
+	StackTrace() pkgerrors.StackTrace
+}
+
+// errorStack returns the stack recorded in the errors of the fields, the innermost one in the chain wins,
+// which is the nearest to where the error occurs. The logrus.ErrorKey field is looked up first,
+// and then the others in the order of their keys.
+func errorStack(fs Fields) stack.CallStack {
+	keys := make([]string, 0, len(fs))
+	for k, v := range fs {
+		if _, ok := v.(error); ok && k != logrus.ErrorKey && !isInternalKey(k) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{logrus.ErrorKey}, keys...)
+
+	var tracer stackTracer
+	for _, k := range keys {
+		err, _ := fs[k].(error)
+		for ; err != nil; err = unwrapCause(err) {
+			if t, ok := err.(stackTracer); ok {
+				tracer = t
+			}
+		}
+
+		if tracer != nil {
+			break
+		}
+	}
+
+	if tracer == nil {
+		return nil
+	}
+
+	st := tracer.StackTrace()
+	pcs := make([]uintptr, len(st))
+	for i, f := range st {
+		pcs[i] = uintptr(f)
+	}
+
+	return stack.FromPCs(pcs)
+}
+
+func unwrapCause(err error) error {
+	if c, ok := err.(interface{ Cause() error }); ok {
+		return c.Cause()
+	}
+	return errors.Unwrap(err)
+}
+
+func parseStack(minus bool, digits string, options string) (Part, error) {
+	return parseStackPart(options)
+}
+
+func parseStackPart(options string) (StackPart, error) {
+	m := parseOptionMap(options)
+	p := StackPart{
+		CallerFormat: parseCallerFormat(m),
+		Depth:        str.ParseInt(m["depth"], 20),
+		TrimRuntime:  str.ParseBool(m["trimruntime"], true),
+	}
+	if p.Func == "" {
+		p.Func = "pkg"
+	}
+	if p.Path == "" {
+		p.Path = "relative"
+	}
+
+	level, err := logrus.ParseLevel(str.Or(m["level"], "error"))
+	if err != nil {
+		return p, err
+	}
+	p.Level = level
+
+	return p, nil
+}
+
+// stackLevel returns the lowest level of the %stack parts in the part, and whether there is any.
+func stackLevel(p Part) (level logrus.Level, ok bool) {
+	merge := func(l logrus.Level, has bool) {
+		if has && (!ok || l > level) {
+			level, ok = l, true
+		}
+	}
+
+	switch v := p.(type) {
+	case StackPart:
+		merge(v.Level, true)
+	case GroupPart:
+		for _, q := range v {
+			merge(stackLevel(q))
+		}
+	case ColorPart:
+		merge(stackLevel(v.Group))
+	case HighlightPart:
+		merge(stackLevel(v.Group))
+	case IfPart:
+		merge(stackLevel(v.Cond))
+		merge(stackLevel(v.Group))
+	case OmitEmptyPart:
+		merge(stackLevel(v.Part))
+	case WidthPart:
+		merge(stackLevel(v.Part))
+	}
+
+	return level, ok
+}
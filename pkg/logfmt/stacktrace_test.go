@@ -0,0 +1,114 @@
+package logfmt_test
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bingoohuang/golog/pkg/logfmt"
+	"github.com/bingoohuang/golog/pkg/rotate"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStack(t *testing.T) {
+	var buf bytes.Buffer
+	layout, err := logfmt.NewLayout(logfmt.Option{Layout: "%msg%stack{depth=1,path=base,func=name}%n"})
+	assert.Nil(t, err)
+
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.AddHook(logfmt.NewHook([]*rotate.WriterFormatter{{
+		LevelWriter: rotate.WrapLevelWriter(&buf),
+		Formatter: &logfmt.LogrusFormatter{Formatter: logfmt.Formatter{
+			Layout: layout,
+		}},
+	}}))
+
+	ll.Info("info")
+	assert.Equal(t, "info\n", buf.String())
+
+	buf.Reset()
+	ll.Error("error")
+	_, _, line, _ := runtime.Caller(0)
+	assert.Equal(t, "error\n\tTestStack stacktrace_test.go:"+strconv.Itoa(line-1)+"\n", buf.String())
+
+	buf.Reset()
+	e := errors.New("boom")
+	_, _, line, _ = runtime.Caller(0)
+	ll.WithError(errors.Wrap(e, "wrapped")).Error("error")
+	assert.Equal(t, "error\n\tTestStack stacktrace_test.go:"+strconv.Itoa(line-1)+"\n", buf.String())
+}
+
+func TestStackJSON(t *testing.T) {
+	var buf bytes.Buffer
+	sp := logfmt.StackPart{
+		CallerFormat: logfmt.CallerFormat{Path: "relative", Func: "pkg"},
+		Level:        logrus.ErrorLevel,
+		Depth:        20,
+		TrimRuntime:  true,
+	}
+
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.AddHook(logfmt.NewHook([]*rotate.WriterFormatter{{
+		LevelWriter: rotate.WrapLevelWriter(&buf),
+		Formatter:   &logfmt.LogrusFormatter{Formatter: logfmt.Formatter{Simple: true, Stack: &sp}},
+	}}))
+
+	ll.Warn("warn")
+	assert.False(t, strings.Contains(buf.String(), `"stack"`), buf.String())
+
+	ll.Error("error")
+	assert.Contains(t, buf.String(), `{"stack":["github.com/bingoohuang/golog/pkg/logfmt_test.TestStackJSON pkg/logfmt/stacktrace_test.go:`)
+}
+
+func TestStackCapture(t *testing.T) {
+	hook := func(layout string) *logfmt.Hook {
+		l, err := logfmt.NewLayout(logfmt.Option{Layout: layout})
+		assert.Nil(t, err)
+		return logfmt.NewHook([]*rotate.WriterFormatter{{
+			LevelWriter: rotate.WrapLevelWriter(io.Discard),
+			Formatter:   &logfmt.LogrusFormatter{Formatter: logfmt.Formatter{Layout: l}},
+		}})
+	}
+
+	assert.False(t, hook("%msg%n").CaptureStack)
+
+	h := hook("%msg%if{fields}(%color{red}(%stack{level=warn}))%n")
+	assert.True(t, h.CaptureStack)
+	assert.Equal(t, logrus.WarnLevel, h.StackLevel)
+}
+
+func TestStackErrorFields(t *testing.T) {
+	var buf bytes.Buffer
+	layout, err := logfmt.NewLayout(logfmt.Option{Layout: "%stack{depth=1,path=base,func=none}%n"})
+	assert.Nil(t, err)
+
+	ll := logrus.New()
+	ll.SetOutput(io.Discard)
+	ll.AddHook(logfmt.NewHook([]*rotate.WriterFormatter{{
+		LevelWriter: rotate.WrapLevelWriter(&buf),
+		Formatter:   &logfmt.LogrusFormatter{Formatter: logfmt.Formatter{Layout: layout}},
+	}}))
+
+	_, _, line, _ := runtime.Caller(0)
+	a := errors.New("a")
+	b := errors.New("b")
+	c := errors.New("c")
+	stackOf := func(line int) string { return "\n\tstacktrace_test.go:" + strconv.Itoa(line) + "\n" }
+
+	for i := 0; i < 20; i++ {
+		buf.Reset()
+		ll.WithFields(logrus.Fields{"z": c, "b": b, "y": a}).Error("sorted keys")
+		assert.Equal(t, stackOf(line+2), buf.String()) // the error of b
+
+		buf.Reset()
+		ll.WithFields(logrus.Fields{"a": a, logrus.ErrorKey: c}).Error("error key first")
+		assert.Equal(t, stackOf(line+3), buf.String())
+	}
+}
@@ -0,0 +1,100 @@
+package logfmt
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/bingoohuang/golog/pkg/caller"
+	"github.com/bingoohuang/golog/pkg/rotate"
+	"github.com/bingoohuang/golog/pkg/stack"
+	"github.com/sirupsen/logrus"
+)
+
+var stderrCaptured sync.Once
+
+// captureStderr redirects the stderr of the process (fd 2) through a pipe into the logger as the error entries,
+// like the runtime panics, the fatal errors and the outputs of the third-party libs, while still tee-ing them
+// to the original stderr, where the debug messages of golog are printed to then. The runtime crash output is written
+// to the logFile directly instead if supported (go1.23+), since the process may exit before the captured lines are logged.
+// Only the first capture in the process takes effect.
+func captureStderr(ll *logrus.Logger, logFile string) (err error) {
+	var pr, orig *os.File
+	stderrCaptured.Do(func() { pr, orig, err = redirectStderr() })
+	if pr == nil {
+		return err
+	}
+
+	rotate.SetInnerOutput(orig)
+	crashLogged := false
+	if logFile != "" && crashOutputSupported {
+		if err := setCrashOutput(logFile); err != nil {
+			rotate.InnerPrint("E! set crash output to %s error %v", logFile, err)
+		} else {
+			crashLogged = true
+		}
+	}
+
+	go pipeStderr(ll, pr, orig, crashLogged)
+	return nil
+}
+
+// pipeStderr tees the lines of the captured stderr to the original one, and logs them as the error entries,
+// except the ones of the runtime crash when crashLogged, which are written to the log file by the runtime already.
+// The crash lines end at the first one not like a traceback, e.g. after a lib prints a panic it recovered.
+func pipeStderr(ll *logrus.Logger, pr io.Reader, orig io.Writer, crashLogged bool) {
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(make([]byte, 0, 4096), 1024*1024)
+	crashing := false
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		_, _ = orig.Write(append(line, '\n'))
+		if crashLogged {
+			if crashing {
+				crashing = isTracebackLine(line)
+			}
+			if !crashing {
+				crashing = bytes.HasPrefix(line, []byte("panic: ")) || bytes.HasPrefix(line, []byte("fatal error: "))
+			}
+		}
+		// the hook failures are printed to the stderr, not to log them again and again
+		if crashing || len(line) == 0 || bytes.HasPrefix(line, []byte("Failed to fire hook")) {
+			continue
+		}
+
+		// no caller or stack trace of this goroutine
+		ll.WithFields(logrus.Fields{caller.Skip: -1, StackKey: stack.CallStack(nil)}).Error(string(line))
+	}
+}
+
+// tracebackPrefixes are the prefixes of the lines in the runtime crash output, following the panic or fatal error.
+var tracebackPrefixes = [][]byte{
+	[]byte("panic: "), []byte("fatal error: "), []byte("[signal "), []byte("goroutine "), []byte("\t"),
+	[]byte("created by "), []byte("runtime stack:"), []byte("..."), []byte("exit status "),
+}
+
+// isTracebackLine tells whether the line may be in the runtime crash output, including the function lines like main.main().
+func isTracebackLine(line []byte) bool {
+	if len(line) == 0 || bytes.HasSuffix(line, []byte(")")) {
+		return true
+	}
+	for _, p := range tracebackPrefixes {
+		if bytes.HasPrefix(line, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// setCrashOutputOnRotate returns the handler to set the crash output to the new log file after rotated.
+func setCrashOutputOnRotate(logFile string) rotate.Handler {
+	return rotate.HandlerFunc(func(e rotate.Event) {
+		if _, ok := e.(*rotate.FileRotatedEvent); ok {
+			if err := setCrashOutput(logFile); err != nil {
+				rotate.InnerPrint("E! set crash output to %s error %v", logFile, err)
+			}
+		}
+	})
+}
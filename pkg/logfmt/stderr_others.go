@@ -0,0 +1,48 @@
+//go:build !windows
+
+package logfmt
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// redirectStderr redirects the fd 2 to a pipe, and returns its read end and the original stderr.
+func redirectStderr() (pr, orig *os.File, err error) {
+	origFd, err := unix.Dup(2)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		_ = unix.Close(origFd)
+		return nil, nil, err
+	}
+	defer pw.Close()
+
+	rc, err := pw.SyscallConn()
+	if err == nil {
+		if ctrlErr := rc.Control(func(fd uintptr) { err = unix.Dup2(int(fd), 2) }); ctrlErr != nil {
+			err = ctrlErr
+		}
+	}
+	if err != nil {
+		_ = pr.Close()
+		_ = unix.Close(origFd)
+		return nil, nil, err
+	}
+
+	// The pipe created by os.Pipe is non-blocking, whose file status flag is shared by the fd 2 after dup2,
+	// so restore the blocking mode, not to be inherited by the child processes writing to their stderr.
+	if err := unix.SetNonblock(2, false); err != nil {
+		_ = pr.Close()
+		_ = unix.Dup2(origFd, 2)
+		_ = unix.Close(origFd)
+		return nil, nil, err
+	}
+
+	os.Stderr = os.NewFile(2, "/dev/stderr")
+	return pr, os.NewFile(uintptr(origFd), "/dev/stderr"), nil
+}
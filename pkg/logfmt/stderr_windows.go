@@ -0,0 +1,11 @@
+package logfmt
+
+import (
+	"errors"
+	"os"
+)
+
+// redirectStderr is not supported on windows.
+func redirectStderr() (pr, orig *os.File, err error) {
+	return nil, nil, errors.New("capturing stderr is not supported on windows")
+}
@@ -0,0 +1,90 @@
+package logfmt
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// fieldsTip parses the fields tip in the std log message, like [F:orderId=123,user=bob],
+// the values can be quoted like [F:name='bingoo huang'].
+var fieldsTip = regexp.MustCompile(`\[F:([^\]]*)]`)
+
+// parseStdFields parses the fields tips in the std log message, and the trailing key=value pairs if trailing is true,
+// the parsed ones are stripped from the message.
+func parseStdFields(msg []byte, trailing bool) (Fields, []byte) {
+	var fs Fields
+	for {
+		loc := fieldsTip.FindSubmatchIndex(msg)
+		if loc == nil {
+			break
+		}
+
+		if fs == nil {
+			fs = Fields{}
+		}
+		for _, f := range splitOptions(string(msg[loc[2]:loc[3]])) {
+			if k, v, ok := strings.Cut(f, "="); ok && k != "" {
+				fs[k] = v
+			}
+		}
+		msg = clearMsg(msg, loc[0], loc[1])
+	}
+
+	if trailing {
+		var tfs Fields
+		if tfs, msg = cutTrailingFields(msg); fs == nil {
+			return tfs, msg
+		}
+		for k, v := range tfs {
+			fs[k] = v
+		}
+	}
+
+	return fs, msg
+}
+
+// cutTrailingFields cuts the key=value pairs separated by spaces at the end of the message,
+// like "order created orderId=123 user=bob", the last one wins for the duplicate keys.
+func cutTrailingFields(msg []byte) (Fields, []byte) {
+	var fs Fields
+	s := bytes.TrimRight(msg, " \t\r\n")
+	end := len(s)
+	for end > 0 {
+		start := bytes.LastIndexAny(s[:end], " \t") + 1
+		k, v, ok := bytes.Cut(s[start:end], []byte("="))
+		if !ok || !isFieldName(k) || bytes.IndexByte(v, '=') >= 0 {
+			break
+		}
+
+		if fs == nil {
+			fs = Fields{}
+		}
+		if _, exists := fs[string(k)]; !exists {
+			fs[string(k)] = string(v)
+		}
+		end = len(bytes.TrimRight(s[:start], " \t"))
+	}
+
+	if fs == nil {
+		return nil, msg
+	}
+
+	return fs, s[:end]
+}
+
+// isFieldName tells whether the name is like a field name, which starts with a letter or underscore,
+// followed by letters, digits, underscores, dots or hyphens.
+func isFieldName(name []byte) bool {
+	if len(name) == 0 || !(isWordByte(name[0]) && (name[0] < '0' || name[0] > '9')) {
+		return false
+	}
+
+	for _, c := range name {
+		if !isWordByte(c) && c != '.' && c != '-' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -1,15 +1,16 @@
 package logfmt
 
 import (
-	"bytes"
 	"fmt"
 	"log"
 	"os"
 	"regexp"
-	"strconv"
+	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 
-	"github.com/bingoohuang/golog/pkg/caller"
+	"github.com/bingoohuang/golog/pkg/rotate"
 	"github.com/bingoohuang/golog/pkg/str"
 	"github.com/sirupsen/logrus"
 )
@@ -17,12 +18,18 @@ import (
 type writerWrapper struct {
 	ll        *logrus.Logger
 	formatter *LogrusFormatter
+	// trailingFields parses the trailing key=value pairs in the message as fields.
+	trailingFields bool
+
+	// async writes the messages of [LOG_ASYNC] in the background, created on the first one.
+	asyncLock sync.Mutex
+	async     atomic.Pointer[rotate.AsyncWriter]
 }
 
 var (
 	// asyncTip parses [LOG_ASYNC] tip in the log message.
-	// [LOG_ASYNC] to send asynchronously with default 10000 queue size.
-	// overflow will be dropped, 1000 can be modified by env GOLOG_ASYNC_QUEUE_SIZE
+	// [LOG_ASYNC] to send asynchronously with default 10000 queue size, which can be modified by env GOLOG_ASYNC_QUEUE_SIZE.
+	// The overflow is dropped by default, or by the policy of env GOLOG_ASYNC_OVERFLOW, see rotate.ParseAsyncOverflow.
 	asyncTip = regexp.MustCompile(`\[LOG_ASYNC]`)
 
 	// logOffTip parses [LOG_OFF] tip in the log message.
@@ -34,13 +41,7 @@ type AsyncConfig struct {
 	QueueSize int
 }
 
-var (
-	asyncCh     chan *bytes.Buffer
-	asyncOnce   sync.Once
-	asyncMissed int
-)
-
-func (w writerWrapper) dealAsync(s []byte) (processed bool) {
+func (w *writerWrapper) dealAsync(s []byte) (processed bool) {
 	if len(logOffTip.FindIndex(s)) > 0 {
 		return true
 	}
@@ -52,45 +53,71 @@ func (w writerWrapper) dealAsync(s []byte) (processed bool) {
 
 	x, y := catches[0], catches[1]
 	s = clearMsg(s, x, y)
-	asyncOnce.Do(func() {
-		size := 10000
-		if v := os.Getenv(`GOLOG_ASYNC_QUEUE_SIZE`); v != "" {
-			if i, _ := strconv.Atoi(v); i > size {
-				size = i
-			}
-		}
-		asyncCh = make(chan *bytes.Buffer, size)
+	// the level for the overflow policy like dropBelow:warn, parsed on a copy since the tags are cleared in place
+	level, _, _, _ := parseLevelFromMsg(append([]byte(nil), s...))
+	_, _ = w.asyncWriter().Write(level, s)
+	return true
+}
 
-		go func() {
-			for msg := range asyncCh {
-				_, _ = w.writeInternal(msg.Bytes())
-				str.PutBytesBuffer(msg)
-			}
-		}()
-	})
+func (w *writerWrapper) asyncWriter() *rotate.AsyncWriter {
+	if a := w.async.Load(); a != nil {
+		return a
+	}
 
-	buf := str.GetBytesBuffer()
-	buf.Write(s)
+	w.asyncLock.Lock()
+	defer w.asyncLock.Unlock()
+	if a := w.async.Load(); a != nil {
+		return a
+	}
+	a := rotate.NewAsyncWriter(rotate.WrapLevelWriter(writerFunc(w.writeInternal)), asyncOptionFromEnv())
+	w.async.Store(a)
+	return a
+}
 
-	select {
-	case asyncCh <- buf:
-	default:
-		asyncMissed++
-		if asyncMissed >= 10000 {
-			buf.Reset()
-			buf.Write([]byte(fmt.Sprintf("asyncMissed %d", asyncMissed)))
-			asyncCh <- buf
-			asyncMissed = 0
+// hasAsync tells whether any message may be queued, by [LOG_ASYNC] or by the async writers of the hooks.
+func (w *writerWrapper) hasAsync() bool {
+	if w.async.Load() != nil {
+		return true
+	}
+
+	for _, hook := range w.ll.Hooks[logrus.FatalLevel] {
+		if h, ok := hook.(*Hook); ok && h.async() {
+			return true
+		}
+	}
+	return false
+}
+
+// asyncOptionFromEnv creates the option of the async std log by the env GOLOG_ASYNC_QUEUE_SIZE and GOLOG_ASYNC_OVERFLOW,
+// each message is written to the sink one by one to log as an entry.
+func asyncOptionFromEnv() rotate.AsyncOption {
+	o := rotate.AsyncOption{
+		QueueSize: str.ParseInt(os.Getenv(`GOLOG_ASYNC_QUEUE_SIZE`), 10000),
+		Overflow:  rotate.AsyncDropNewest,
+		PerEntry:  true,
+		OnDrop: func(dropped uint64) []byte {
+			return []byte(fmt.Sprintf("W! async log queue overflow, %d dropped", dropped))
+		},
+	}
+
+	if v := os.Getenv(`GOLOG_ASYNC_OVERFLOW`); v != "" {
+		overflow, keepLevel, err := rotate.ParseAsyncOverflow(v)
+		if err != nil {
+			rotate.InnerPrint("E! bad GOLOG_ASYNC_OVERFLOW %v", err)
 		} else {
-			str.PutBytesBuffer(buf)
+			o.Overflow, o.KeepLevel = overflow, keepLevel
 		}
 	}
 
-	return true
+	return o
 }
 
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
+
 func clearMsg(s []byte, x, y int) []byte {
-	for ; x >= 0 && s[x] == ' '; x-- {
+	for ; x > 0 && s[x-1] == ' '; x-- {
 	}
 	for ; y < len(s) && s[y] == ' '; y++ {
 	}
@@ -102,7 +129,16 @@ func clearMsg(s []byte, x, y int) []byte {
 	return append(z, s[y:]...)
 }
 
-func (w writerWrapper) Write(p []byte) (n int, err error) {
+func (w *writerWrapper) Write(p []byte) (n int, err error) {
+	// the untagged message of log.Fatal or log.Panic is logged at info, so flush explicitly before the exit or panic,
+	// only looking up the callers when anything may be queued
+	if w.hasAsync() && fromStdFatal() {
+		if a := w.async.Load(); a != nil {
+			a.Flush() // the [LOG_ASYNC] messages queued before are written first
+		}
+		defer w.flush()
+	}
+
 	if w.dealAsync(p) {
 		return 0, nil
 	}
@@ -110,28 +146,53 @@ func (w writerWrapper) Write(p []byte) (n int, err error) {
 	return w.writeInternal(p)
 }
 
-func (w writerWrapper) writeInternal(p []byte) (n int, err error) {
-	level, msg, _ := ParseLevelFromMsg(p)
+// fromStdFatal tells whether the writing is called by log.Fatal*, log.Panic*, or the ones of log.Logger.
+func fromStdFatal() bool {
+	var pcs [8]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs[:])])
+	for {
+		f, more := frames.Next()
+		if fn, ok := strings.CutPrefix(f.Function, "log."); ok {
+			fn = fn[strings.LastIndexByte(fn, '.')+1:]
+			if strings.HasPrefix(fn, "Fatal") || strings.HasPrefix(fn, "Panic") {
+				return true
+			}
+		}
+		if !more {
+			return false
+		}
+	}
+}
 
-	if s, ok := Limit(w.ll, level, msg, w.formatter); !ok {
-		w.ll.WithField(caller.Skip, 11).Log(level, str.ToString(s))
+// flush waits until the messages of [LOG_ASYNC] and the entries queued by the async writers are written.
+func (w *writerWrapper) flush() {
+	if a := w.async.Load(); a != nil {
+		a.Flush()
 	}
 
-	return 0, nil
+	for _, hook := range w.ll.Hooks[logrus.FatalLevel] {
+		if h, ok := hook.(*Hook); ok {
+			h.Flush()
+		}
+	}
 }
 
-var (
-	// regLevelTip parses the log level tip. the following tip is supported:
-	// T! for trace
-	// D! for debug
-	// I! for info
-	// W! for warn
-	// E! for error
-	// F! for fatal
-	// P! for panic
-	regLevelTip       = regexp.MustCompile(`\b[TDIWEFP]!`)
-	customizeLevelMap = map[string]logrus.Level{}
-)
+func (w *writerWrapper) writeInternal(p []byte) (n int, err error) {
+	level, custom, msg, _ := parseLevelFromMsg(p)
+	fields, msg := parseStdFields(msg, w.trailingFields)
+
+	// the limited one is emitted later with the fields and at the custom level
+	e := w.ll.WithFields(logrus.Fields(fields))
+	if s, ok := limit(e, level, custom, msg, w.formatter); !ok {
+		if custom != "" {
+			LogLevel(e, custom, str.ToString(s))
+		} else {
+			e.Log(level, str.ToString(s))
+		}
+	}
+
+	return 0, nil
+}
 
 func levelMapper(b byte) logrus.Level {
 	switch b {
@@ -154,34 +215,48 @@ func levelMapper(b byte) logrus.Level {
 	}
 }
 
-// RegisterLevelKey customizes the log level key in the message, like [DEBUG] for debugging level.
-func RegisterLevelKey(levelKey string, level logrus.Level) {
-	customizeLevelMap[levelKey] = level
+// ParseLevelFromMsg parses the level tag in the message, the custom levels are parsed to their logrus levels.
+func ParseLevelFromMsg(msg []byte) (level logrus.Level, s []byte, foundLevelTag bool) {
+	level, _, s, foundLevelTag = parseLevelFromMsg(msg)
+	return level, s, foundLevelTag
 }
 
-func ParseLevelFromMsg(msg []byte) (level logrus.Level, s []byte, foundLevelTag bool) {
-	for levelKey, customLevel := range customizeLevelMap {
-		if x := bytes.Index(msg, []byte(levelKey)); x >= 0 {
-			s = clearMsg(msg, x, x+len(levelKey))
-			return customLevel, s, true
+// parseLevelFromMsg parses the level in the message by the registered level keys first, and then the tags:
+// T! for trace, D! for debug, I! for info, W! for warn, E! for error, F! for fatal, P! for panic,
+// and the ones of the custom levels like N! for notice, whose name is returned as custom.
+func parseLevelFromMsg(msg []byte) (level logrus.Level, custom string, s []byte, foundLevelTag bool) {
+	if k, x := findLevelKey(msg); x >= 0 {
+		level, s = k.Level, msg
+		if k.Custom != "" {
+			if lv, ok := LookupLevel(k.Custom); ok {
+				level, custom = lv.Logrus(), lv.Name
+			}
 		}
+		if !k.Keep {
+			s = clearMsg(msg, x, x+len(k.Key))
+		}
+		return level, custom, s, true
 	}
 
-	if l := regLevelTip.FindIndex(msg); len(l) > 0 {
+	if l := loadLevels().tagRe.FindIndex(msg); len(l) > 0 {
 		x, y := l[0], l[1]
-		level = levelMapper(msg[x])
+		if lv, ok := lookupLevelTag(string(msg[x:y])); ok {
+			level, custom = lv.Logrus(), lv.Name
+		} else {
+			level = levelMapper(msg[x])
+		}
 		if level <= logrus.PanicLevel {
 			fmt.Println()
 		}
 		s = clearMsg(msg, x, y)
-		return level, s, true
+		return level, custom, s, true
 	}
 
-	return logrus.InfoLevel, msg, false
+	return logrus.InfoLevel, "", msg, false
 }
 
-func fixStd(ll *logrus.Logger, formatter *LogrusFormatter) {
+func fixStd(ll *logrus.Logger, formatter *LogrusFormatter, trailingFields bool) {
 	log.SetFlags(0)
 	log.SetPrefix("")
-	log.SetOutput(&writerWrapper{ll: ll, formatter: formatter})
+	log.SetOutput(&writerWrapper{ll: ll, formatter: formatter, trailingFields: trailingFields})
 }
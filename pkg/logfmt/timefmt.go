@@ -0,0 +1,146 @@
+package logfmt
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bingoohuang/golog/pkg/str"
+	"github.com/bingoohuang/golog/pkg/strftime"
+	"github.com/bingoohuang/golog/pkg/timex"
+)
+
+// Time prints the time of the entry, like %t{yyyy-MM-dd HH:mm:ss.SSS}, %t{layout=RFC3339Nano,tz=UTC},
+// %t{unixms} or %t{%Y-%m-%d %H:%M:%S.%L}.
+type Time struct {
+	// Format is the go layout.
+	Format string
+	// Epoch is one of unix, unixms and unixnano to print the epoch time instead.
+	Epoch string
+	// Strftime is the compiled strftime or SimpleDateFormat style pattern to print instead.
+	Strftime *strftime.Strftime
+	// Location is the time zone to print in, nil for the time zone of the entry.
+	Location *time.Location
+}
+
+func (t Time) Append(b *bytes.Buffer, e Entry) {
+	b.WriteString(t.String(timex.OrNow(e.Time())))
+}
+
+// String formats the time.
+func (t Time) String(tm time.Time) string {
+	if t.Location != nil {
+		tm = tm.In(t.Location)
+	}
+
+	switch {
+	case t.Epoch == "unix":
+		return strconv.FormatInt(tm.Unix(), 10)
+	case t.Epoch == "unixms":
+		return strconv.FormatInt(tm.UnixMilli(), 10)
+	case t.Epoch == "unixnano":
+		return strconv.FormatInt(tm.UnixNano(), 10)
+	case t.Strftime != nil:
+		return t.Strftime.FormatString(tm)
+	case t.Format == "":
+		return tm.Format(layout)
+	default:
+		return tm.Format(t.Format)
+	}
+}
+
+var timePresets = map[string]string{
+	"iso8601":     "2006-01-02T15:04:05.000Z07:00",
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+}
+
+// timeOptionRe matches the known keys of the %time options, the value runs to the next known key,
+// so that the layout can contain commas like layout=HH:mm:ss,SSS.
+var timeOptionRe = regexp.MustCompile(`(?i)(?:^|,)\s*(layout|format|strftime|tz)=`)
+
+// parseTimeOptions parses the options of the known keys, or else the whole options is the layout.
+func parseTimeOptions(options string) map[string]string {
+	locs := timeOptionRe.FindAllStringSubmatchIndex(options, -1)
+	if len(locs) == 0 || locs[0][0] != 0 {
+		return map[string]string{"layout": options}
+	}
+
+	m := map[string]string{}
+	for i, loc := range locs {
+		end := len(options)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		m[strings.ToLower(options[loc[2]:loc[3]])] = options[loc[1]:end]
+	}
+
+	return m
+}
+
+func parseTime(minus bool, digits string, options string) (Part, error) {
+	m := parseTimeOptions(options)
+	t := Time{}
+
+	if tz := m["tz"]; tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("bad tz %s of %%time: %w", tz, err)
+		}
+		t.Location = loc
+	}
+
+	pattern := m["strftime"]
+	l := strings.TrimSpace(str.Or(m["layout"], m["format"]))
+	if pattern == "" && strings.Contains(l, "%") {
+		pattern = l
+	}
+
+	if pattern != "" {
+		f, err := strftime.New(pattern, strftime.WithMilliseconds('L'))
+		if err != nil {
+			return nil, fmt.Errorf("bad strftime %s of %%time: %w", pattern, err)
+		}
+		t.Strftime = f
+		return t, nil
+	}
+
+	switch lower := strings.ToLower(l); lower {
+	case "unix", "unixms", "unixnano":
+		t.Epoch = lower
+	case "":
+		t.Format = layout
+	default:
+		if preset, ok := timePresets[lower]; ok {
+			t.Format = preset
+			break
+		}
+
+		f, err := strftime.NewSimpleDateFormat(l)
+		if err != nil {
+			return nil, fmt.Errorf("bad layout %s of %%time: %w", l, err)
+		}
+		t.Strftime = f
+	}
+
+	return t, nil
+}
+
+var timeIndicatorRe = regexp.MustCompile(`%-?[\d.-]*(?:time|t)(?:\{([^}]*)}|[^a-zA-Z{]|$)`)
+
+// findTime finds the first %time in the layout to format the time.Time fields, or the default one when absent.
+func findTime(expr string) Time {
+	options := ""
+	if m := timeIndicatorRe.FindStringSubmatch(expr); m != nil {
+		options = m[1]
+	}
+
+	if p, err := parseTime(false, "", options); err == nil {
+		return p.(Time)
+	}
+
+	return Time{Format: layout}
+}
@@ -0,0 +1,131 @@
+package logfmt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// TruncateMarker returns the marker appended to the truncated text, like …[truncated 100 bytes].
+func TruncateMarker(n int) string { return "…[truncated " + strconv.Itoa(n) + " bytes]" }
+
+// Truncate truncates s to at most max bytes with the marker appended (without breaking the UTF-8 characters),
+// and counts the truncation in the metrics.
+func Truncate(s string, max int) string {
+	t, n := truncate(s, max)
+	if n > 0 {
+		CountTruncated(n)
+	}
+	return t
+}
+
+// truncate truncates s to at most max bytes, the marker included, and returns the number of bytes truncated.
+// Only the marker is left when max is less than the marker.
+func truncate(s string, max int) (string, int) {
+	if len(s) <= max {
+		return s, 0
+	}
+
+	// the marker of len(s) bytes is not shorter than the one of the bytes truncated actually
+	cut := max - len(TruncateMarker(len(s)))
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	n := len(s) - cut
+	return s[:cut] + TruncateMarker(n), n
+}
+
+// CountTruncated counts a truncation of n bytes in the metrics.
+func CountTruncated(n int) {
+	metrics.truncations.Add(1)
+	metrics.truncatedBytes.Add(uint64(n))
+}
+
+// truncatedEntry is the entry with the message and the text fields truncated to fit the max entry size.
+type truncatedEntry struct {
+	Entry
+	message string
+	fields  Fields
+}
+
+func (e truncatedEntry) Message() string { return e.message }
+func (e truncatedEntry) Fields() Fields  { return e.fields }
+
+type truncateItem struct {
+	key  string // empty for the message
+	text string
+}
+
+// truncateText returns the text of the field value to measure and truncate, the composite ones like a giant struct
+// are measured by their JSON encodings, and replaced by the truncated ones when truncated.
+func truncateText(v interface{}) (string, bool) {
+	if s, ok := textValue(v); ok {
+		return s, true
+	}
+	if !isComposite(v) {
+		return "", false
+	}
+	if data, err := json.Marshal(v); err == nil {
+		return string(data), true
+	}
+	return fmt.Sprintf("%+v", v), true
+}
+
+// truncateEntry truncates the message and the text and composite fields when their total size exceeds max bytes.
+// The budget is shared fairly: the small ones are kept intact, and the large ones are truncated to the equal share
+// of the rest, so that a giant field does not squeeze out the message. The truncations are counted in the metrics
+// if count is true.
+func truncateEntry(e Entry, max int, count bool) Entry {
+	fs := e.Fields()
+	items := []truncateItem{{text: e.Message()}}
+	total := len(items[0].text)
+	for k, v := range fs {
+		if isInternalKey(k) {
+			continue
+		}
+		if s, ok := truncateText(v); ok {
+			items = append(items, truncateItem{key: k, text: s})
+			total += len(s)
+		}
+	}
+
+	if total <= max {
+		return e
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return len(items[i].text) < len(items[j].text) })
+
+	te := truncatedEntry{Entry: e, fields: make(Fields, len(fs))}
+	for k, v := range fs {
+		te.fields[k] = v
+	}
+
+	remaining := max
+	for i, item := range items {
+		share := remaining / (len(items) - i)
+		text := item.text
+		if len(text) > share {
+			var n int
+			if text, n = truncate(text, share); count {
+				CountTruncated(n)
+			}
+			remaining -= share
+		} else {
+			remaining -= len(text)
+		}
+
+		if item.key == "" {
+			te.message = text
+		} else if text != item.text {
+			te.fields[item.key] = text
+		}
+	}
+
+	return te
+}
@@ -0,0 +1,155 @@
+package logfmt
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bingoohuang/golog/pkg/str"
+)
+
+// Width is the logback style format modifier like %-20.30caller.
+// The output is padded to at least Min columns, right justified unless LeftAlign is set,
+// and truncated to at most Max columns, from the beginning unless TruncateRight is set (%.-30).
+// Columns are counted by display width, so that CJK characters take two and ANSI colors take none.
+type Width struct {
+	Min           int
+	Max           int
+	LeftAlign     bool
+	TruncateRight bool
+	ZeroPad       bool
+}
+
+// IsZero tells the modifier does nothing.
+func (w Width) IsZero() bool { return w.Min <= 0 && w.Max <= 0 }
+
+// parseWidth parses the width modifier like 20.30 or 20.-30 with the leading minus flag.
+func parseWidth(minus bool, digits string) Width {
+	w := Width{LeftAlign: minus}
+	minDigits, maxDigits, hasMax := strings.Cut(digits, ".")
+	w.ZeroPad = !minus && strings.HasPrefix(minDigits, "0")
+	w.Min = str.ParseInt(minDigits, 0)
+
+	if hasMax {
+		if strings.HasPrefix(maxDigits, "-") {
+			w.TruncateRight = true
+			maxDigits = maxDigits[1:]
+		}
+		w.Max = str.ParseInt(maxDigits, 0)
+	}
+
+	return w
+}
+
+// Write writes s to b with the width modifier applied.
+func (w Width) Write(b *bytes.Buffer, s []byte) {
+	cols := displayWidth(s)
+	if w.Max > 0 && cols > w.Max {
+		if w.TruncateRight {
+			s = truncateRight(s, w.Max)
+		} else {
+			s = truncateLeft(s, cols-w.Max)
+		}
+		cols = displayWidth(s)
+	}
+
+	if cols >= w.Min {
+		b.Write(s)
+		return
+	}
+
+	pad := " "
+	if w.ZeroPad {
+		pad = "0"
+	}
+
+	padding := strings.Repeat(pad, w.Min-cols)
+	if w.LeftAlign {
+		b.Write(s)
+		b.WriteString(padding)
+	} else {
+		b.WriteString(padding)
+		b.Write(s)
+	}
+}
+
+func displayWidth(s []byte) (cols int) {
+	for len(s) > 0 {
+		if n := str.SkipANSI(s); n > 0 {
+			s = s[n:]
+			continue
+		}
+
+		r, n := utf8.DecodeRune(s)
+		cols += str.RuneWidth(r)
+		s = s[n:]
+	}
+
+	return cols
+}
+
+// truncateRight keeps the leading max columns of s, escape sequences are always kept.
+func truncateRight(s []byte, max int) []byte {
+	t := make([]byte, 0, len(s))
+	cols := 0
+	for len(s) > 0 {
+		if n := str.SkipANSI(s); n > 0 {
+			t = append(t, s[:n]...)
+			s = s[n:]
+			continue
+		}
+
+		r, n := utf8.DecodeRune(s)
+		if cols += str.RuneWidth(r); cols <= max {
+			t = append(t, s[:n]...)
+		}
+		s = s[n:]
+	}
+
+	return t
+}
+
+// truncateLeft drops the leading drop columns of s, escape sequences are always kept.
+func truncateLeft(s []byte, drop int) []byte {
+	t := make([]byte, 0, len(s))
+	cols := 0
+	for len(s) > 0 {
+		if n := str.SkipANSI(s); n > 0 {
+			t = append(t, s[:n]...)
+			s = s[n:]
+			continue
+		}
+
+		r, n := utf8.DecodeRune(s)
+		if cols < drop {
+			cols += str.RuneWidth(r)
+		} else {
+			t = append(t, s[:n]...)
+		}
+		s = s[n:]
+	}
+
+	return t
+}
+
+// WidthPart applies the width modifier to the wrapped part.
+type WidthPart struct {
+	Part
+	Width Width
+}
+
+func (p WidthPart) Append(b *bytes.Buffer, e Entry) {
+	buf := str.GetBytesBuffer()
+	defer str.PutBytesBuffer(buf)
+
+	p.Part.Append(buf, e)
+	p.Width.Write(b, buf.Bytes())
+}
+
+func (p WidthPart) ResetForLogFile() Part {
+	if v, ok := p.Part.(LogFileReset); ok {
+		p.Part = v.ResetForLogFile()
+	}
+
+	return p
+}
@@ -0,0 +1,79 @@
+package redact
+
+import "regexp"
+
+// builtinRules returns the built-in detectors, which are applied in order.
+func builtinRules() []Rule {
+	return []Rule{
+		{
+			Name:    "authorization",
+			Pattern: regexp.MustCompile(`(?im)^(?:authorization|proxy-authorization|cookie|set-cookie)[ \t]*:[ \t]*([^\r\n]+)`),
+			Fields:  []string{"authorization", "cookie"},
+		},
+		{
+			Name:    "password",
+			Pattern: regexp.MustCompile(`(?i)(?:password|passwd|pwd)["']?\s*[:=]\s*["']?([^"'&\s,;}]+)`),
+			Fields:  []string{"password", "passwd", "pwd"},
+		},
+		{
+			Name:    "jwt",
+			Pattern: regexp.MustCompile(`\beyJ[\w-]+\.eyJ[\w-]+\.[\w-]*`),
+		},
+		{
+			Name:       "idCard",
+			Pattern:    regexp.MustCompile(`\b[1-9]\d{5}(?:18|19|20)\d{2}(?:0[1-9]|1[0-2])(?:0[1-9]|[12]\d|3[01])\d{3}[\dXx]\b`),
+			Validate:   validIDCard,
+			KeepPrefix: 4, KeepSuffix: 4,
+		},
+		{
+			Name:       "creditCard",
+			Pattern:    regexp.MustCompile(`\b[2-6]\d{3}(?:[ -]?\d{4}){2}[ -]?\d{1,7}\b`),
+			Validate:   validLuhn,
+			KeepSuffix: 4,
+		},
+		{
+			Name:       "mobile",
+			Pattern:    regexp.MustCompile(`(?:\+|\b)(?:86[ -]?)?(1[3-9]\d{9})\b`),
+			KeepPrefix: 3, KeepSuffix: 4,
+		},
+	}
+}
+
+// validIDCard validates the check digit of the 18 digits Chinese ID card number.
+func validIDCard(s string) bool {
+	weights := [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, w := range weights {
+		sum += int(s[i]-'0') * w
+	}
+
+	check := "10X98765432"[sum%11]
+	last := s[17]
+	if last == 'x' {
+		last = 'X'
+	}
+
+	return last == check
+}
+
+// validLuhn validates the credit card number by the Luhn algorithm, the spaces and dashes are ignored.
+func validLuhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+
+	return n >= 13 && n <= 19 && sum%10 == 0
+}
@@ -0,0 +1,367 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Action defines how to redact the detected sensitive data.
+type Action string
+
+const (
+	// Mask replaces the sensitive data with ****, keeping the prefix and suffix defined by the rule.
+	Mask Action = "mask"
+	// Hash replaces the sensitive data with the prefix of its HMAC-SHA256 by the HashKey, which can still be correlated.
+	Hash Action = "hash"
+	// Drop removes the sensitive data, or the whole field.
+	Drop Action = "drop"
+)
+
+// ParseAction parses the action of mask, hash or drop.
+func ParseAction(s string) (Action, error) {
+	switch a := Action(strings.ToLower(s)); a {
+	case Mask, Hash, Drop:
+		return a, nil
+	default:
+		return "", fmt.Errorf("unknown redact action %s", s)
+	}
+}
+
+// Rule defines a detector of the sensitive data.
+type Rule struct {
+	Name string
+	// Pattern detects the sensitive data in the text, the first capturing group is redacted if any,
+	// or else the whole match.
+	Pattern *regexp.Regexp
+	// Validate validates the detected value further, like the Luhn check of the credit card numbers.
+	Validate func(string) bool
+	// Fields are the names of the fields whose values are redacted entirely,
+	// matched by containing case-insensitively.
+	Fields []string
+	// Action is the default action, Mask if empty.
+	Action Action
+	// KeepPrefix and KeepSuffix are the number of runes to keep when masking.
+	KeepPrefix, KeepSuffix int
+	// HashKey is the HMAC key of the Hash action, the random one per process is used if empty,
+	// see Redactor.SetHashKey.
+	HashKey []byte
+}
+
+// processHashKey is the random HMAC key when no HashKey is set, the hashes are correlatable only in the process.
+var processHashKey = func() []byte {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	return key
+}()
+
+// Value redacts the sensitive value by the action.
+func (r Rule) Value(v string) string {
+	switch r.Action {
+	case Drop:
+		return ""
+	case Hash:
+		// the keyed hash, the plain one of the small spaces like the mobile numbers is reversible by enumeration
+		key := r.HashKey
+		if len(key) == 0 {
+			key = processHashKey
+		}
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(v))
+		return "hmac:" + hex.EncodeToString(h.Sum(nil)[:8])
+	default:
+		rs := []rune(v)
+		if len(rs) <= r.KeepPrefix+r.KeepSuffix {
+			return "****"
+		}
+		return string(rs[:r.KeepPrefix]) + "****" + string(rs[len(rs)-r.KeepSuffix:])
+	}
+}
+
+// Text redacts the sensitive data detected by the pattern in the text.
+func (r Rule) Text(s string) string {
+	if r.Pattern == nil {
+		return s
+	}
+
+	matches := r.Pattern.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+
+		v := s[start:end]
+		if r.Validate != nil && !r.Validate(v) {
+			continue
+		}
+
+		b.WriteString(s[last:start])
+		b.WriteString(r.Value(v))
+		last = end
+	}
+
+	if last == 0 {
+		return s
+	}
+
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// MatchField tells whether the field of the name should be redacted by the rule.
+func (r Rule) MatchField(name string) bool {
+	name = strings.ToLower(name)
+	for _, f := range r.Fields {
+		if strings.Contains(name, strings.ToLower(f)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var (
+	registryLock sync.Mutex
+	// registry holds the registered rules ([]Rule) in order, built-in ones first, copied on write.
+	registry atomic.Value
+)
+
+func init() {
+	registry.Store(builtinRules())
+}
+
+// Register registers the rules which can be enabled by their names in the spec like redact=mobile|myRule,
+// the existing one of the same name is replaced.
+func Register(rules ...Rule) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	old := registry.Load().([]Rule)
+	rs := make([]Rule, 0, len(old)+len(rules))
+	for _, r := range old {
+		if findRule(rules, r.Name) < 0 {
+			rs = append(rs, r)
+		}
+	}
+
+	registry.Store(append(rs, rules...))
+}
+
+// RegisterRegex registers a rule by the regular expression, the first capturing group is redacted if any.
+func RegisterRegex(name, pattern string, action Action) error {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+
+	Register(Rule{Name: name, Pattern: re, Action: action})
+	return nil
+}
+
+// RegisterField registers a rule to redact the fields of the names.
+func RegisterField(name string, action Action, fields ...string) {
+	Register(Rule{Name: name, Fields: fields, Action: action})
+}
+
+func findRule(rules []Rule, name string) int {
+	for i, r := range rules {
+		if strings.EqualFold(r.Name, name) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Redactor redacts the sensitive data by the rules, the nil *Redactor does nothing.
+type Redactor struct {
+	Rules []Rule
+}
+
+// New creates a Redactor by the spec like mobile|idCard:hash|password:drop, which enables the registered rules
+// by names, with the optional actions to override. all enables all the registered rules.
+// It returns nil for the empty spec.
+func New(spec string) (*Redactor, error) {
+	if spec = strings.TrimSpace(spec); spec == "" {
+		return nil, nil
+	}
+
+	registered := registry.Load().([]Rule)
+	r := &Redactor{}
+	for _, item := range strings.Split(spec, "|") {
+		name, action, hasAction := strings.Cut(strings.TrimSpace(item), ":")
+		if name == "" {
+			continue
+		}
+
+		var rules []Rule
+		if strings.EqualFold(name, "all") {
+			rules = append(rules, registered...)
+		} else if i := findRule(registered, name); i >= 0 {
+			rules = append(rules, registered[i])
+		} else {
+			return nil, fmt.Errorf("unknown redact rule %s", name)
+		}
+
+		if hasAction {
+			a, err := ParseAction(action)
+			if err != nil {
+				return nil, err
+			}
+			for i := range rules {
+				rules[i].Action = a
+			}
+		}
+
+		r.Rules = append(r.Rules, rules...)
+	}
+
+	return r, nil
+}
+
+// String redacts the sensitive data in the text.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+
+	for _, rule := range r.Rules {
+		s = rule.Text(s)
+	}
+
+	return s
+}
+
+// Bytes redacts the sensitive data in the text.
+func (r *Redactor) Bytes(b []byte) []byte {
+	if r == nil {
+		return b
+	}
+
+	s := string(b)
+	if t := r.String(s); t != s {
+		return []byte(t)
+	}
+
+	return b
+}
+
+// Field redacts the value of the field by the field rules, it returns false if the field should be dropped.
+func (r *Redactor) Field(name, value string) (string, bool) {
+	if r == nil {
+		return value, true
+	}
+
+	for _, rule := range r.Rules {
+		if rule.MatchField(name) {
+			if rule.Action == Drop {
+				return "", false
+			}
+			return rule.Value(value), true
+		}
+	}
+
+	return r.String(value), true
+}
+
+// SetHashKey sets the HMAC key of the Hash action of the rules, which should be the same secret
+// across the deployment to correlate the hashes, like by the redactKey of the spec.
+func (r *Redactor) SetHashKey(key []byte) {
+	if r == nil || len(key) == 0 {
+		return
+	}
+
+	for i := range r.Rules {
+		r.Rules[i].HashKey = key
+	}
+}
+
+// JSON redacts the value decoded from JSON, like map[string]interface{} and []interface{}, recursively:
+// the values of the sensitive keys by the field rules, and the other strings by the text rules.
+// It returns the redacted value and whether anything is redacted.
+func (r *Redactor) JSON(v interface{}) (interface{}, bool) {
+	if r == nil {
+		return v, false
+	}
+
+	switch t := v.(type) {
+	case string:
+		s := r.String(t)
+		return s, s != t
+	case []interface{}:
+		changed := false
+		for i, e := range t {
+			var c bool
+			if t[i], c = r.JSON(e); c {
+				changed = true
+			}
+		}
+		return t, changed
+	case map[string]interface{}:
+		changed := false
+		for k, e := range t {
+			if !r.IsSensitiveField(k) {
+				var c bool
+				if t[k], c = r.JSON(e); c {
+					changed = true
+				}
+				continue
+			}
+
+			s, ok := e.(string)
+			if !ok {
+				b, _ := json.Marshal(e)
+				s = string(b)
+			}
+			if rs, keep := r.Field(k, s); keep {
+				t[k] = rs
+			} else {
+				delete(t, k)
+			}
+			changed = true
+		}
+		return t, changed
+	default:
+		return v, false
+	}
+}
+
+// IsSensitiveField tells whether the field of the name should be redacted entirely.
+func (r *Redactor) IsSensitiveField(name string) bool {
+	if r == nil {
+		return false
+	}
+
+	for _, rule := range r.Rules {
+		if rule.MatchField(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+var defaultRedactor atomic.Value
+
+// SetDefault sets the default Redactor, like the one by the spec of golog, to be used by hlog dumps.
+func SetDefault(r *Redactor) { defaultRedactor.Store(r) }
+
+// Default returns the default Redactor, which may be nil to do nothing.
+func Default() *Redactor {
+	r, _ := defaultRedactor.Load().(*Redactor)
+	return r
+}
@@ -0,0 +1,298 @@
+package rotate
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bingoohuang/golog/pkg/gid"
+	"github.com/sirupsen/logrus"
+)
+
+// AsyncOverflow defines what to do with the entry when the queue of the AsyncWriter is full.
+// The ERROR and more severe entries are never dropped by any policy, but wait for the room.
+type AsyncOverflow int
+
+const (
+	// AsyncBlock blocks the writing until the queue has room.
+	AsyncBlock AsyncOverflow = iota
+	// AsyncDropNewest drops the entry being written.
+	AsyncDropNewest
+	// AsyncDropOldest drops the oldest entry less severe than ERROR in the queue to make room.
+	AsyncDropOldest
+	// AsyncDropBelowLevel drops the entries less severe than the KeepLevel, and blocks for the others.
+	AsyncDropBelowLevel
+)
+
+// ParseAsyncOverflow parses the overflow policy like block, dropNewest, dropOldest or dropBelow:warn,
+// which returns the keep level of dropBelow, case-insensitively.
+func ParseAsyncOverflow(s string) (overflow AsyncOverflow, keepLevel logrus.Level, err error) {
+	name, level, hasLevel := strings.Cut(s, ":")
+	switch strings.ToLower(strings.ReplaceAll(name, "-", "")) {
+	case "block":
+		return AsyncBlock, 0, nil
+	case "dropnewest", "drop":
+		return AsyncDropNewest, 0, nil
+	case "dropoldest":
+		return AsyncDropOldest, 0, nil
+	case "dropbelow":
+		if !hasLevel {
+			return AsyncDropBelowLevel, logrus.WarnLevel, nil
+		}
+		keepLevel, err = logrus.ParseLevel(level)
+		return AsyncDropBelowLevel, keepLevel, err
+	default:
+		return 0, 0, fmt.Errorf("unknown async overflow policy %q", s)
+	}
+}
+
+// AsyncOption defines the options of the AsyncWriter.
+type AsyncOption struct {
+	// QueueSize is the max number of the entries queued, default 10000.
+	QueueSize int
+	// BatchSize is the max number of the entries taken from the queue to write in one batch, default 128.
+	BatchSize int
+	// PerEntry writes the entries one by one to the sink, instead of joining the consecutive ones of the same level,
+	// like the sink taking each write as a message.
+	PerEntry bool
+	// Overflow is what to do when the queue is full, default AsyncBlock.
+	Overflow AsyncOverflow
+	// KeepLevel is the least severe level not dropped by AsyncDropBelowLevel, like logrus.WarnLevel.
+	KeepLevel logrus.Level
+	// OnDrop is called in the writing goroutine with the number of the entries dropped since the last call,
+	// and returns the notice to write to the sink directly at the warn level, nil for none.
+	OnDrop func(dropped uint64) []byte
+}
+
+// AsyncStats is the stats of the AsyncWriter.
+type AsyncStats struct {
+	// Queued is the number of the entries in the queue, and MaxQueued is the max one ever.
+	Queued, MaxQueued int
+	// Written is the number of the entries written to the sink.
+	Written uint64
+	// Dropped is the number of the entries dropped for overflow.
+	Dropped uint64
+	// Latency is the time the last written entry waited in the queue, and MaxLatency is the max one ever.
+	Latency, MaxLatency time.Duration
+}
+
+type asyncEntry struct {
+	level logrus.Level
+	name  string // the custom level name for the LevelNameWriter sink
+	p     []byte
+	at    time.Time
+}
+
+// AsyncWriter is the LevelWriter which queues the entries and writes them to the sink in a goroutine,
+// the consecutive entries of the same level (and custom level name) in a batch are written at once, unless PerEntry.
+type AsyncWriter struct {
+	sink   LevelWriter
+	option AsyncOption
+
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	queue    []asyncEntry
+	// writing is the number of the entries taken from the queue and not written yet.
+	writing int
+	closed  bool
+	done    chan struct{}
+	// worker is the writing goroutine, which never blocks on the full queue.
+	worker gid.GoroutineID
+
+	maxQueued           int
+	latency, maxLatency time.Duration
+
+	written, dropped atomic.Uint64
+	// reported is the number of the dropped entries reported to OnDrop.
+	reported uint64
+}
+
+// NewAsyncWriter creates an AsyncWriter to write to the sink, and starts its writing goroutine.
+func NewAsyncWriter(sink LevelWriter, option AsyncOption) *AsyncWriter {
+	if option.QueueSize <= 0 {
+		option.QueueSize = 10000
+	}
+	if option.BatchSize <= 0 {
+		option.BatchSize = 128
+	}
+
+	a := &AsyncWriter{sink: sink, option: option, done: make(chan struct{})}
+	a.notEmpty = sync.NewCond(&a.mu)
+	a.notFull = sync.NewCond(&a.mu)
+	go a.run()
+
+	return a
+}
+
+// Write queues the copy of p, or writes it to the sink directly after the AsyncWriter is closed.
+func (a *AsyncWriter) Write(level logrus.Level, p []byte) (int, error) {
+	return a.WriteLevelName(level, "", p)
+}
+
+// WriteLevelName queues the copy of p with the custom level name, which is passed to the sink if it is a LevelNameWriter.
+func (a *AsyncWriter) WriteLevelName(level logrus.Level, name string, p []byte) (int, error) {
+	a.mu.Lock()
+	for !a.closed && len(a.queue) >= a.option.QueueSize {
+		queued, beyond := a.overflow(level)
+		if !queued {
+			a.mu.Unlock()
+			a.dropped.Add(1)
+			return len(p), nil
+		}
+		if beyond {
+			break
+		}
+	}
+
+	if a.closed {
+		a.mu.Unlock()
+		return WriteLevelName(a.sink, level, name, p)
+	}
+
+	a.queue = append(a.queue, asyncEntry{level: level, name: name, p: append([]byte(nil), p...), at: time.Now()})
+	if len(a.queue) > a.maxQueued {
+		a.maxQueued = len(a.queue)
+	}
+	a.notEmpty.Signal()
+	a.mu.Unlock()
+
+	return len(p), nil
+}
+
+// overflow handles the full queue by the policy, and tells whether to queue the entry,
+// and whether to queue it beyond the size, like the ERROR+ one of the writing goroutine which never waits for itself.
+func (a *AsyncWriter) overflow(level logrus.Level) (queued, beyond bool) {
+	kept := level <= logrus.ErrorLevel
+	switch o := a.option.Overflow; {
+	case !kept && (o == AsyncDropNewest || o == AsyncDropBelowLevel && level > a.option.KeepLevel):
+		return false, false
+	case o == AsyncDropOldest && a.dropOldest():
+	default:
+		if gid.CurGoroutineID() == a.worker { // like logging back to itself by the sink
+			return kept, kept
+		}
+		a.notFull.Wait()
+	}
+
+	return true, false
+}
+
+// dropOldest drops the oldest entry less severe than ERROR in the queue, and tells whether dropped.
+func (a *AsyncWriter) dropOldest() bool {
+	for i, e := range a.queue {
+		if e.level > logrus.ErrorLevel {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			a.dropped.Add(1)
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+
+	a.mu.Lock()
+	a.worker = gid.CurGoroutineID()
+	a.mu.Unlock()
+
+	var batch []asyncEntry
+	var buf []byte
+
+	for {
+		a.mu.Lock()
+		for len(a.queue) == 0 && !a.closed {
+			a.notEmpty.Wait()
+		}
+		if len(a.queue) == 0 { // closed and drained
+			a.mu.Unlock()
+			return
+		}
+
+		n := len(a.queue)
+		if n > a.option.BatchSize {
+			n = a.option.BatchSize
+		}
+		batch = append(batch[:0], a.queue[:n]...)
+		a.queue = a.queue[n:]
+		a.writing = n
+		a.notFull.Broadcast()
+		a.mu.Unlock()
+
+		for i := 0; i < len(batch); {
+			buf = append(buf[:0], batch[i].p...)
+			j := i + 1
+			for ; !a.option.PerEntry && j < len(batch) && batch[j].level == batch[i].level && batch[j].name == batch[i].name; j++ {
+				buf = append(buf, batch[j].p...)
+			}
+
+			_, _ = WriteLevelName(a.sink, batch[i].level, batch[i].name, buf)
+			a.written.Add(uint64(j - i))
+			i = j
+		}
+
+		a.mu.Lock()
+		a.writing = 0
+		// the latency of the batch is the one of its first entry, which waited the longest
+		if a.latency = time.Since(batch[0].at); a.latency > a.maxLatency {
+			a.maxLatency = a.latency
+		}
+		a.notFull.Broadcast()
+		a.mu.Unlock()
+
+		a.reportDropped()
+	}
+}
+
+func (a *AsyncWriter) reportDropped() {
+	if a.option.OnDrop == nil {
+		return
+	}
+
+	if dropped := a.dropped.Load(); dropped > a.reported {
+		n := dropped - a.reported
+		a.reported = dropped
+		if notice := a.option.OnDrop(n); len(notice) > 0 {
+			_, _ = a.sink.Write(logrus.WarnLevel, notice)
+		}
+	}
+}
+
+// Flush waits until the entries queued are written to the sink.
+func (a *AsyncWriter) Flush() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for (len(a.queue) > 0 || a.writing > 0) && !a.closed {
+		a.notFull.Wait()
+	}
+}
+
+// Close writes the entries queued to the sink and stops the writing goroutine,
+// the later entries are written to the sink directly.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	a.closed = true
+	a.notEmpty.Broadcast()
+	a.notFull.Broadcast()
+	a.mu.Unlock()
+
+	<-a.done
+	return nil
+}
+
+// Stats returns the stats of the AsyncWriter.
+func (a *AsyncWriter) Stats() AsyncStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return AsyncStats{
+		Queued: len(a.queue), MaxQueued: a.maxQueued,
+		Written: a.written.Load(), Dropped: a.dropped.Load(),
+		Latency: a.latency, MaxLatency: a.maxLatency,
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/bingoohuang/golog/pkg/lock"
 	"github.com/bingoohuang/golog/pkg/str"
+	"github.com/bingoohuang/golog/pkg/strftime"
 )
 
 // Handler defines the event handler interface.
@@ -35,10 +36,10 @@ type Rotate struct {
 	outFh   FlushWriteCloser
 
 	maintainLock        *lock.Try
-	rotatePostfixLayout string
+	rotatePostfixLayout *strftime.Strftime
 
 	logfile      string
-	rotateLayout string
+	rotateLayout *strftime.Strftime
 	curFnBase    string
 	curFn        string
 	gzipAge      time.Duration
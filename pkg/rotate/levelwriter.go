@@ -10,6 +10,23 @@ type LevelWriter interface {
 	Write(level logrus.Level, p []byte) (n int, err error)
 }
 
+// LevelNameWriter is the LevelWriter told the name of the custom level too, like NOTICE logged by the logrus
+// info level, to route the entries by the custom levels.
+type LevelNameWriter interface {
+	LevelWriter
+	// WriteLevelName writes p of the level, the name is the custom level name or empty for the logrus levels.
+	WriteLevelName(level logrus.Level, name string, p []byte) (n int, err error)
+}
+
+// WriteLevelName writes p to w with the custom level name if w is a LevelNameWriter, or else by the level only.
+func WriteLevelName(w LevelWriter, level logrus.Level, name string, p []byte) (int, error) {
+	if nw, ok := w.(LevelNameWriter); ok {
+		return nw.WriteLevelName(level, name, p)
+	}
+
+	return w.Write(level, p)
+}
+
 type levelWriter struct {
 	io.Writer
 }
@@ -3,7 +3,7 @@ package rotate
 import (
 	"time"
 
-	"github.com/bingoohuang/golog/pkg/spec"
+	"github.com/bingoohuang/golog/pkg/strftime"
 )
 
 // Option defines the option interface.
@@ -72,15 +72,39 @@ func WithHandler(v Handler) OptionFn {
 }
 
 // WithRotateLayout creates a layout for the postfix of rotated file.
-// eg. .2006-01-02 for daily rotation.
+// eg. .yyyy-MM-dd or .2006-01-02 for daily rotation.
 func WithRotateLayout(v string) OptionFn {
-	return func(r *Rotate) { r.rotatePostfixLayout = spec.ConvertTimeLayout(v) }
+	return func(r *Rotate) {
+		if f, ok := compileLayout(v); ok {
+			r.rotatePostfixLayout = f
+		}
+	}
 }
 
 // WithRotateFullLayout creates a layout of the final rotated file.
-// eg. log/2006-01-02/file.log for daily rotation layout.
+// eg. log/yyyy-MM-dd/file.log or log/2006-01-02/file.log for daily rotation layout.
 func WithRotateFullLayout(v string) OptionFn {
-	return func(r *Rotate) { r.rotateLayout = spec.ConvertTimeLayout(v) }
+	return func(r *Rotate) {
+		if f, ok := compileLayout(v); ok {
+			r.rotateLayout = f
+		}
+	}
+}
+
+// compileLayout compiles the SimpleDateFormat style layout like .yyyy-MM-dd, or the go layout like .2006-01-02.
+// The empty layout results in nil.
+func compileLayout(v string) (*strftime.Strftime, bool) {
+	if v == "" {
+		return nil, true
+	}
+
+	f, err := strftime.NewSimpleDateFormat(v)
+	if err != nil {
+		InnerPrint("E! bad rotate layout %s error %v", v, err)
+		return nil, false
+	}
+
+	return f, true
 }
 
 // WithMaxSize set how much max size should a log file be rotated.
@@ -10,11 +10,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/bingoohuang/golog/pkg/compress"
 	"github.com/bingoohuang/golog/pkg/homedir"
 	"github.com/bingoohuang/golog/pkg/lock"
+	"github.com/bingoohuang/golog/pkg/strftime"
 	"github.com/bingoohuang/golog/pkg/timex"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -32,6 +34,8 @@ var GologDebug = func() bool {
 	}
 }()
 
+var defaultPostfixLayout, _ = strftime.NewSimpleDateFormat(".yyyy-MM-dd")
+
 // New creates a new Rotate object. A logfile filename
 // must be passed. Optional `Option` parameters may be passed.
 func New(logfile string, options ...OptionFn) (*Rotate, error) {
@@ -43,8 +47,7 @@ func New(logfile string, options ...OptionFn) (*Rotate, error) {
 	r := &Rotate{
 		logfile:             logfile,
 		clock:               Local,
-		rotateLayout:        "",
-		rotatePostfixLayout: ".2006-01-02",
+		rotatePostfixLayout: defaultPostfixLayout,
 		maxAge:              timex.Week,
 		maintainLock:        lock.NewTry(),
 	}
@@ -66,11 +69,16 @@ func New(logfile string, options ...OptionFn) (*Rotate, error) {
 
 func (rl *Rotate) GenBaseFilename() (string, time.Time) {
 	now := rl.clock.Now()
-	if rl.rotateLayout != "" {
-		return now.Format(rl.rotateLayout + rl.rotatePostfixLayout), now
+	postfix := ""
+	if rl.rotatePostfixLayout != nil {
+		postfix = rl.rotatePostfixLayout.FormatString(now)
+	}
+
+	if rl.rotateLayout != nil {
+		return rl.rotateLayout.FormatString(now) + postfix, now
 	}
 
-	return rl.logfile + now.Format(rl.rotatePostfixLayout), now
+	return rl.logfile + postfix, now
 }
 
 var enableFlushWarn = func() logrus.Level {
@@ -388,6 +396,12 @@ func (rl *Rotate) Close() error {
 	return err
 }
 
+// innerOutput is the output of InnerPrint, like the original stderr when the stderr is captured into the log.
+var innerOutput atomic.Value
+
+// SetInnerOutput sets the output of InnerPrint, default os.Stderr.
+func SetInnerOutput(w io.Writer) { innerOutput.Store(&w) }
+
 func InnerPrint(format string, a ...interface{}) {
 	if !GologDebug {
 		return
@@ -398,5 +412,9 @@ func InnerPrint(format string, a ...interface{}) {
 		m += "\n"
 	}
 
-	fmt.Fprintf(os.Stderr, "%s %s", time.Now().Format("2006-01-02 15:04:05.000"), m)
+	var w io.Writer = os.Stderr
+	if p, ok := innerOutput.Load().(*io.Writer); ok {
+		w = *p
+	}
+	fmt.Fprintf(w, "%s %s", time.Now().Format("2006-01-02 15:04:05.000"), m)
 }
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -44,6 +45,20 @@ func TestGenFilename(t *testing.T) {
 	}
 }
 
+func TestGenFilenameNoDigits(t *testing.T) {
+	xt := time.Date(2026, 10, 19, 0, 0, 0, 0, time.Local)
+	for layout, expected := range map[string]string{".EEE": "a.log.Mon", ".MMMM": "a.log.October"} {
+		rl, err := rotate.New("a.log", rotate.WithClock(clock.NewMockAt(xt)), rotate.WithRotateLayout(layout))
+		if !assert.NoError(t, err, "New should succeed") {
+			return
+		}
+
+		fn, _ := rl.GenBaseFilename()
+		_ = rl.Close()
+		assert.Equal(t, expected, fn)
+	}
+}
+
 func TestGenPathFilename(t *testing.T) {
 	ts := []time.Time{{}, (time.Time{}).Add(24 * time.Hour)} // Mock time
 
@@ -377,3 +392,142 @@ func TestGHIssue23(t *testing.T) {
 		}
 	}
 }
+
+// gateSink records the writes after the gate is opened.
+type gateSink struct {
+	gate   chan struct{}
+	mu     sync.Mutex
+	writes []string
+}
+
+func (s *gateSink) Write(level logrus.Level, p []byte) (int, error) {
+	<-s.gate
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes = append(s.writes, level.String()+":"+string(p))
+	return len(p), nil
+}
+
+// echoSink writes the errors back to the AsyncWriter on the first write, like logging back by the sink.
+type echoSink struct {
+	a      *rotate.AsyncWriter
+	echoed bool // only by the writing goroutine
+	mu     sync.Mutex
+	writes []string
+}
+
+func (s *echoSink) Write(level logrus.Level, p []byte) (int, error) {
+	if !s.echoed {
+		s.echoed = true
+		for i := 0; i < 3; i++ {
+			_, _ = s.a.Write(logrus.ErrorLevel, []byte("echo"))
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.writes = append(s.writes, level.String()+":"+string(p))
+	return len(p), nil
+}
+
+func TestAsyncWriterEcho(t *testing.T) {
+	for _, overflow := range []rotate.AsyncOverflow{rotate.AsyncBlock, rotate.AsyncDropNewest} {
+		sink := &echoSink{}
+		sink.a = rotate.NewAsyncWriter(sink, rotate.AsyncOption{QueueSize: 2, Overflow: overflow})
+		_, _ = sink.a.Write(logrus.InfoLevel, []byte("a"))
+		sink.a.Flush()
+		_ = sink.a.Close()
+		// the errors of the writing goroutine are queued beyond the size of 2, instead of dropped or blocked
+		assert.Equal(t, []string{"info:a", "error:echoechoecho"}, sink.writes)
+		assert.Equal(t, uint64(0), sink.a.Stats().Dropped)
+	}
+}
+
+func TestAsyncWriter(t *testing.T) {
+	write := func(a *rotate.AsyncWriter, level logrus.Level, msgs ...string) {
+		for _, m := range msgs {
+			_, _ = a.Write(level, []byte(m))
+		}
+	}
+
+	// the first one is taken by the writing goroutine blocked on the gate, then the queue of 2 is full
+	newWriter := func(option rotate.AsyncOption) (*rotate.AsyncWriter, *gateSink) {
+		sink := &gateSink{gate: make(chan struct{})}
+		option.QueueSize = 2
+		a := rotate.NewAsyncWriter(sink, option)
+		write(a, logrus.InfoLevel, "a")
+		for a.Stats().Queued > 0 {
+			time.Sleep(time.Millisecond)
+		}
+		return a, sink
+	}
+
+	a, sink := newWriter(rotate.AsyncOption{Overflow: rotate.AsyncDropNewest})
+	write(a, logrus.InfoLevel, "b", "c", "d")
+	write(a, logrus.WarnLevel, "e")
+	close(sink.gate)
+	_ = a.Close()
+	assert.Equal(t, []string{"info:a", "info:bc"}, sink.writes)
+	stats := a.Stats()
+	assert.Equal(t, 2, stats.MaxQueued)
+	assert.Equal(t, uint64(3), stats.Written)
+	assert.Equal(t, uint64(2), stats.Dropped)
+	assert.True(t, stats.MaxLatency > 0)
+
+	a, sink = newWriter(rotate.AsyncOption{Overflow: rotate.AsyncDropOldest})
+	write(a, logrus.InfoLevel, "b", "c", "d")
+	write(a, logrus.WarnLevel, "e")
+	close(sink.gate)
+	_ = a.Close()
+	assert.Equal(t, []string{"info:a", "info:d", "warning:e"}, sink.writes)
+
+	var dropped uint64
+	a, sink = newWriter(rotate.AsyncOption{Overflow: rotate.AsyncDropBelowLevel, KeepLevel: logrus.WarnLevel,
+		OnDrop: func(n uint64) []byte { dropped += n; return []byte("dropped") }})
+	write(a, logrus.InfoLevel, "b", "c", "d")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(sink.gate)
+	}()
+	write(a, logrus.WarnLevel, "e") // blocks until the gate opened
+	_ = a.Close()
+	assert.Equal(t, []string{"info:a", "warning:dropped", "info:bc", "warning:e"}, sink.writes)
+	assert.Equal(t, uint64(1), dropped)
+
+	_, err := a.Write(logrus.ErrorLevel, []byte("f")) // written directly after closed
+	assert.NoError(t, err)
+	assert.Equal(t, "error:f", sink.writes[4])
+
+	a, sink = newWriter(rotate.AsyncOption{PerEntry: true})
+	write(a, logrus.InfoLevel, "b", "c")
+	close(sink.gate)
+	_ = a.Close()
+	assert.Equal(t, []string{"info:a", "info:b", "info:c"}, sink.writes)
+
+	// the ERROR+ entries are never dropped by any policy
+	a, sink = newWriter(rotate.AsyncOption{Overflow: rotate.AsyncDropNewest})
+	write(a, logrus.InfoLevel, "b", "c")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(sink.gate)
+	}()
+	write(a, logrus.ErrorLevel, "e") // blocks until the gate opened
+	_ = a.Close()
+	assert.Equal(t, []string{"info:a", "info:bc", "error:e"}, sink.writes)
+	assert.Equal(t, uint64(0), a.Stats().Dropped)
+
+	a, sink = newWriter(rotate.AsyncOption{Overflow: rotate.AsyncDropOldest})
+	write(a, logrus.ErrorLevel, "x")
+	write(a, logrus.InfoLevel, "b", "c")
+	write(a, logrus.ErrorLevel, "y")
+	close(sink.gate)
+	_ = a.Close()
+	assert.Equal(t, []string{"info:a", "error:xy"}, sink.writes)
+	assert.Equal(t, uint64(2), a.Stats().Dropped)
+
+	overflow, level, err := rotate.ParseAsyncOverflow("drop-below:error")
+	assert.NoError(t, err)
+	assert.Equal(t, rotate.AsyncDropBelowLevel, overflow)
+	assert.Equal(t, logrus.ErrorLevel, level)
+	_, _, err = rotate.ParseAsyncOverflow("bad")
+	assert.Error(t, err)
+}
@@ -1,23 +1,23 @@
 package spec
 
-import "strings"
+import "github.com/bingoohuang/golog/pkg/strftime"
 
+// Layout is the SimpleDateFormat style layout like .yyyy-MM-dd, or the go layout like .2006-01-02,
+// kept as is to be compiled by strftime.NewSimpleDateFormat once.
 type Layout string
 
 func (l *Layout) Parse(s string) error {
-	*l = Layout(ConvertTimeLayout(s))
+	*l = Layout(s)
 	return nil
 }
 
+// ConvertTimeLayout converts the SimpleDateFormat style layout like yyyy-MM-dd to the go layout like 2006-01-02,
+// the literal text can be quoted like yyyy-MM-dd'T'HH:mm:ss. The layout is returned unchanged when it cannot be
+// converted, like the literal text 'Mon' clashing with the go layout, which is left to strftime.NewSimpleDateFormat.
 func ConvertTimeLayout(s string) string {
-	s = strings.ReplaceAll(s, "yyyy", "2006")
-	s = strings.ReplaceAll(s, "yy", "06")
-	s = strings.ReplaceAll(s, "MM", "01")
-	s = strings.ReplaceAll(s, "dd", "02")
-	s = strings.ReplaceAll(s, "hh", "03")
-	s = strings.ReplaceAll(s, "HH", "15")
-	s = strings.ReplaceAll(s, "mm", "04")
-	s = strings.ReplaceAll(s, "ss", "05")
-	s = strings.ReplaceAll(s, "SSS", "000")
+	if l, err := strftime.SimpleDateToGoLayout(s); err == nil {
+		return l
+	}
+
 	return s
 }
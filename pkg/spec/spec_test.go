@@ -24,9 +24,19 @@ func TestParseSpec(t *testing.T) {
 	assert.Nil(t, spec.ParseSpec(s, "spec", &l))
 	assert.Equal(t, logSpec{
 		Level:      "info",
-		Rotate:     ".2006-01-02",
+		Rotate:     ".yyyy-MM-dd",
 		MaxAge:     30 * timex.Day,
 		MaxSize:    110 * spec.MiB,
 		PrintColor: false,
 	}, l)
+
+	// kept as is, compiled by strftime.NewSimpleDateFormat once, even no digits in the go layout of it
+	assert.Nil(t, spec.ParseSpec("rotate=.EEE", "spec", &l))
+	assert.Equal(t, spec.Layout(".EEE"), l.Rotate)
+}
+
+func TestConvertTimeLayout(t *testing.T) {
+	assert.Equal(t, ".2006-01-02T15", spec.ConvertTimeLayout(".yyyy-MM-dd'T'HH"))
+	// kept unchanged for strftime.NewSimpleDateFormat when the literal text clashes with the go layout
+	assert.Equal(t, ".yyyy-MM-dd'Mon'", spec.ConvertTimeLayout(".yyyy-MM-dd'Mon'"))
 }
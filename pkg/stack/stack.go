@@ -245,6 +245,25 @@ func Trace() CallStack {
 	return cs
 }
 
+// FromPCs returns a CallStack from the program counters like the ones returned by runtime.Callers,
+// or recorded in the errors of github.com/pkg/errors.
+func FromPCs(pcs []uintptr) CallStack {
+	frames := runtime.CallersFrames(pcs)
+	cs := make(CallStack, 0, len(pcs))
+
+	for {
+		frame, more := frames.Next()
+		if frame.PC != 0 {
+			cs = append(cs, Call{frame: frame})
+		}
+		if !more {
+			break
+		}
+	}
+
+	return cs
+}
+
 // TrimBelow returns a slice of the CallStack with all entries below c
 // removed.
 func (cs CallStack) TrimBelow(c Call) CallStack {
@@ -0,0 +1,63 @@
+package str
+
+import "unicode"
+
+// wideRanges are the East Asian Wide and Fullwidth ranges, which occupy two columns on the terminal.
+var wideRanges = [][2]rune{
+	{0x1100, 0x115F}, {0x2E80, 0x303E}, {0x3041, 0x33FF}, {0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF}, {0xA000, 0xA4CF}, {0xAC00, 0xD7A3}, {0xF900, 0xFAFF},
+	{0xFE30, 0xFE4F}, {0xFF00, 0xFF60}, {0xFFE0, 0xFFE6}, {0x1F300, 0x1F64F},
+	{0x1F900, 0x1F9FF}, {0x20000, 0x2FFFD}, {0x30000, 0x3FFFD},
+}
+
+// RuneWidth returns the number of columns the rune occupies when displayed.
+func RuneWidth(r rune) int {
+	switch {
+	case r < 0x20 || r == 0x7F:
+		return 0
+	case r < 0x300:
+		return 1
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || r == 0x200B:
+		return 0
+	}
+
+	for _, w := range wideRanges {
+		if r < w[0] {
+			return 1
+		}
+		if r <= w[1] {
+			return 2
+		}
+	}
+
+	return 1
+}
+
+// SkipANSI returns the length of the ANSI escape sequence at the beginning of s, or 0 if there is none.
+func SkipANSI(s []byte) int {
+	if len(s) < 2 || s[0] != 0x1b {
+		return 0
+	}
+
+	switch s[1] {
+	case '[': // CSI, terminated by a byte in 0x40–0x7E
+		for i := 2; i < len(s); i++ {
+			if s[i] >= 0x40 && s[i] <= 0x7E {
+				return i + 1
+			}
+		}
+		return len(s)
+	case ']': // OSC, terminated by BEL or ST
+		for i := 2; i < len(s); i++ {
+			if s[i] == 0x07 {
+				return i + 1
+			}
+			if s[i] == 0x1b && i+1 < len(s) && s[i+1] == '\\' {
+				return i + 2
+			}
+		}
+		return len(s)
+	}
+
+	return 2
+}
@@ -0,0 +1,289 @@
+package strftime
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// dateToken is a token of the SimpleDateFormat pattern, a run of the same pattern letter, or the literal text.
+type dateToken struct {
+	letter  byte
+	count   int
+	literal string
+}
+
+// dateLetters are the supported pattern letters of SimpleDateFormat.
+const dateLetters = "yMdHhmsSEaDzZX"
+
+// goLayoutRefs are the parts of the go reference time, the pattern containing any of them is taken as a go layout.
+// nolint:gochecknoglobals
+var goLayoutRefs = []string{"2006", "15:04", "04:05"}
+
+// tokenizeSimpleDate splits the SimpleDateFormat pattern into tokens.
+// The text in single quotes is literal, two single quotes represent a single quote.
+// The words of letters are literal when they contain any letter not supported, like log in app.log,
+// so that they need not to be quoted.
+func tokenizeSimpleDate(p string) ([]dateToken, error) {
+	var tokens []dateToken
+
+	var lit strings.Builder
+
+	flush := func() {
+		if lit.Len() > 0 {
+			tokens = append(tokens, dateToken{literal: lit.String()})
+			lit.Reset()
+		}
+	}
+
+	for i := 0; i < len(p); {
+		c := p[i]
+
+		switch {
+		case c == '\'':
+			if i+1 < len(p) && p[i+1] == '\'' {
+				lit.WriteByte('\'')
+				i += 2
+
+				continue
+			}
+
+			closed := false
+			for i++; i < len(p) && !closed; i++ {
+				switch {
+				case p[i] != '\'':
+					lit.WriteByte(p[i])
+				case i+1 < len(p) && p[i+1] == '\'': // '' in quotes
+					lit.WriteByte('\'')
+					i++
+				default:
+					closed = true
+				}
+			}
+
+			if !closed {
+				return nil, errors.Errorf("unterminated quote in pattern %s", p)
+			}
+		case isASCIILetter(c):
+			j := i
+			for j < len(p) && isASCIILetter(p[j]) {
+				j++
+			}
+
+			word := p[i:j]
+			if strings.Trim(word, dateLetters) != "" {
+				lit.WriteString(word)
+				i = j
+
+				continue
+			}
+
+			flush()
+
+			for k := 0; k < len(word); {
+				n := 1
+				for k+n < len(word) && word[k+n] == word[k] {
+					n++
+				}
+
+				tokens = append(tokens, dateToken{letter: word[k], count: n})
+				k += n
+			}
+
+			i = j
+		default:
+			lit.WriteByte(c)
+			i++
+		}
+	}
+
+	flush()
+
+	return tokens, nil
+}
+
+func isASCIILetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// isGoLayout tells whether the pattern is a go layout like .2006-01-02, instead of a SimpleDateFormat one,
+// for the backward compatibility.
+func isGoLayout(p string, tokens []dateToken) bool {
+	for _, ref := range goLayoutRefs {
+		if strings.Contains(p, ref) {
+			return true
+		}
+	}
+
+	for _, t := range tokens {
+		if t.literal == "" {
+			return false
+		}
+	}
+
+	return strings.ContainsAny(p, "0123456789")
+}
+
+// NewSimpleDateFormat creates a Strftime by the java SimpleDateFormat style pattern, like yyyy-MM-dd'T'HH:mm:ss.SSSXXX.
+// The supported letters are y, M (MMM for Jan, MMMM for January), d, H, h, m, s, S (fraction of second),
+// E (EEEE for Monday), a (AM/PM), D (day of year), z (zone name), Z (-0700) and X (XXX for -07:00, Z for UTC).
+// The go layout like .2006-01-02 is also accepted for the backward compatibility.
+func NewSimpleDateFormat(p string) (*Strftime, error) {
+	tokens, err := tokenizeSimpleDate(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if isGoLayout(p, tokens) {
+		return &Strftime{pattern: p, compiled: appenderList{StdlibFormat(p)}}, nil
+	}
+
+	var list appenderList
+
+	for _, t := range tokens {
+		if t.literal != "" {
+			list = append(list, Verbatim(t.literal))
+		} else {
+			list = append(list, simpleDateAppender(t.letter, t.count))
+		}
+	}
+
+	return &Strftime{pattern: p, compiled: list}, nil
+}
+
+// layoutProbes are the times whose fields are all different, to verify the converted go layout.
+// nolint:gochecknoglobals,gomnd
+var layoutProbes = []time.Time{
+	time.Date(2345, 11, 28, 19, 48, 37, 987654321, time.FixedZone("XYZ", 5*3600+30*60)),
+	time.Date(1987, 6, 9, 8, 7, 6, 123456789, time.FixedZone("UVW", -(9*3600+15*60))),
+}
+
+// SimpleDateToGoLayout converts the SimpleDateFormat style pattern to the go layout as close as possible,
+// for the use cases which need a go layout. The patterns taken as go layouts are returned unchanged.
+// An error is returned when the literal text clashes with the go reference time, like 'Mon' or '01',
+// which cannot be escaped in a go layout, use NewSimpleDateFormat to format it instead.
+func SimpleDateToGoLayout(p string) (string, error) {
+	tokens, err := tokenizeSimpleDate(p)
+	if err != nil {
+		return "", err
+	}
+
+	if isGoLayout(p, tokens) {
+		return p, nil
+	}
+
+	var b strings.Builder
+
+	for _, t := range tokens {
+		if t.literal != "" {
+			b.WriteString(t.literal)
+		} else {
+			b.WriteString(simpleDateGoLayout(t.letter, t.count))
+		}
+	}
+
+	layout := b.String()
+	f, err := NewSimpleDateFormat(p)
+	if err != nil {
+		return "", err
+	}
+
+	for _, t := range layoutProbes {
+		if t.Format(layout) != f.FormatString(t) {
+			return "", errors.Errorf("literal text in pattern %s clashes with the go layout %s", p, layout)
+		}
+	}
+
+	return layout, nil
+}
+
+// nolint:gomnd
+func simpleDateGoLayout(letter byte, count int) string {
+	switch letter {
+	case 'y':
+		return pick(count, "2006", "06", "2006")
+	case 'M':
+		return pick(count, "1", "01", "Jan", "January")
+	case 'd':
+		return pick(count, "2", "02")
+	case 'H':
+		return "15"
+	case 'h':
+		return pick(count, "3", "03")
+	case 'm':
+		return pick(count, "4", "04")
+	case 's':
+		return pick(count, "5", "05")
+	case 'S':
+		return strings.Repeat("0", minInt(count, 9))
+	case 'E':
+		return pick(count, "Mon", "Mon", "Mon", "Monday")
+	case 'a':
+		return "PM"
+	case 'D':
+		return pick(count, "__2", "__2", "002")
+	case 'z':
+		return "MST"
+	case 'Z':
+		return "-0700"
+	default: // 'X'
+		return pick(count, "Z07", "Z0700", "Z07:00")
+	}
+}
+
+// pick picks the choice by the count of the letter, the last one for the larger counts.
+func pick(count int, choices ...string) string {
+	if count > len(choices) {
+		return choices[len(choices)-1]
+	}
+
+	return choices[count-1]
+}
+
+// nolint:gomnd
+func simpleDateAppender(letter byte, count int) Appender {
+	switch letter {
+	case 'H':
+		if count == 1 {
+			return AppendFunc(func(b []byte, t time.Time) []byte { return strconv.AppendInt(b, int64(t.Hour()), 10) })
+		}
+	case 'S':
+		return fractionSecond(minInt(count, 9))
+	case 'D':
+		return AppendFunc(func(b []byte, t time.Time) []byte { return appendPadded(b, t.YearDay(), count) })
+	}
+
+	return StdlibFormat(simpleDateGoLayout(letter, count))
+}
+
+// fractionSecond appends the fraction of second of the digits, truncated.
+type fractionSecond int
+
+// nolint:gomnd
+func (v fractionSecond) Append(b []byte, t time.Time) []byte {
+	n := t.Nanosecond()
+	for i := int(v); i < 9; i++ {
+		n /= 10
+	}
+
+	return appendPadded(b, n, int(v))
+}
+
+func appendPadded(b []byte, n, width int) []byte {
+	s := strconv.Itoa(n)
+	for i := len(s); i < width; i++ {
+		b = append(b, '0')
+	}
+
+	return append(b, s...)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
@@ -259,3 +259,45 @@ func TestGHIssue9(t *testing.T) {
 		return
 	}
 }
+
+func TestSimpleDateFormat(t *testing.T) {
+	tm := time.Date(2024, 3, 5, 14, 7, 9, 123456789, time.FixedZone("CST", 8*3600))
+	cases := map[string]string{
+		"yyyy-MM-dd HH:mm:ss.SSS":      "2024-03-05 14:07:09.123",
+		"yy/M/d H:m:s,S":               "24/3/5 14:7:9,1",
+		"EEE, dd MMM yyyy hh:mm a":     "Tue, 05 Mar 2024 02:07 PM",
+		"EEEE MMMM":                    "Tuesday March",
+		"yyyy-MM-dd'T'HH:mm:ssXXX":     "2024-03-05T14:07:09+08:00",
+		"HHmmss Z X XX z":              "140709 +0800 +08 +0800 CST",
+		"DDD SSSSSS":                   "065 123456",
+		"'yyyy' ''MM'' 'it''s'":        "yyyy '03' it's",
+		"app01/yyyyMMdd/host_zone.log": "app01/20240305/host_zone.log",
+		"log/yyyy-MM-dd/hello.log":     "log/2024-03-05/hello.log",
+		".2006-01-02":                  ".2024-03-05",
+		"2006-01-02T15:04:05Z07:00":    "2024-03-05T14:07:09+08:00",
+	}
+
+	for p, expected := range cases {
+		f, err := strftime.NewSimpleDateFormat(p)
+		assert.Nil(t, err, p)
+		assert.Equal(t, expected, f.FormatString(tm), p)
+	}
+
+	_, err := strftime.NewSimpleDateFormat("yyyy'unterminated")
+	assert.NotNil(t, err)
+
+	l, err := strftime.SimpleDateToGoLayout("yyyy-MM-dd'T'HH:mm:ss.SSS")
+	assert.Nil(t, err)
+	assert.Equal(t, "2006-01-02T15:04:05.000", l)
+
+	// the literal text clashing with the go reference time cannot be converted to the go layout
+	for _, p := range []string{"yyyy-MM-dd'Mon'", "yyyy'01'", "'0'M", "HH'PM'", "app01/yyyyMMdd"} {
+		_, err = strftime.SimpleDateToGoLayout(p)
+		assert.NotNil(t, err, p)
+	}
+
+	// but formatted as is by NewSimpleDateFormat
+	f, err := strftime.NewSimpleDateFormat("yyyy-MM-dd'Mon' '01'")
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-03-05Mon 01", f.FormatString(tm))
+}